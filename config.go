@@ -4,48 +4,175 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
-)
 
-const (
-	yamlConfig = "sqlc.yaml"
-	jsonConfig = "sqlc.json"
+	"github.com/walterwanderley/sqlc-grpc/metadata"
 )
 
+var configFiles = []string{"sqlc.yaml", "sqlc.yml", "sqlc.json"}
+
 type PackageConfig struct {
 	Name                      string `json:"name" yaml:"name"`
 	Path                      string `json:"path" yaml:"path"`
 	Engine                    string `json:"engine" yaml:"engine"`
+	SqlPackage                string `json:"sql_package" yaml:"sql_package"`
 	EmitInterface             bool   `json:"emit_interface" yaml:"emit_interface"`
 	EmitResultStructPointers  bool   `json:"emit_result_struct_pointers" yaml:"emit_result_struct_pointers"`
 	EmitParamsStructPointers  bool   `json:"emit_params_struct_pointers" yaml:"emit_params_struct_pointers"`
 	EmitMethodsWithDBArgument bool   `json:"emit_methods_with_db_argument" yaml:"emit_methods_with_db_argument"`
+	Queries                   paths  `json:"queries" yaml:"queries"`
+	Schema                    paths  `json:"schema" yaml:"schema"`
 }
 
 type sqlcConfig struct {
+	Version  string          `json:"version" yaml:"version"`
 	Packages []PackageConfig `json:"packages" yaml:"packages"`
+	SQL      []sqlConfig     `json:"sql" yaml:"sql"`
+	Plugins  []pluginConfig  `json:"plugins" yaml:"plugins"`
 }
 
-func readConfig() (sqlcConfig, error) {
-	var cfg sqlcConfig
-	name, err := configFile()
+// sqlConfig is an entry of the "sql" list of the sqlc configuration version 2
+type sqlConfig struct {
+	Engine  string          `json:"engine" yaml:"engine"`
+	Queries paths           `json:"queries" yaml:"queries"`
+	Schema  paths           `json:"schema" yaml:"schema"`
+	Gen     genConfig       `json:"gen" yaml:"gen"`
+	Codegen []codegenConfig `json:"codegen" yaml:"codegen"`
+}
+
+// codegenConfig is a codegen plugin of an "sql" entry, the Go code is written by the sqlc-gen-go plugin
+type codegenConfig struct {
+	Plugin  string      `json:"plugin" yaml:"plugin"`
+	Out     string      `json:"out" yaml:"out"`
+	Options goGenConfig `json:"options" yaml:"options"`
+}
+
+type pluginConfig struct {
+	Name string `json:"name" yaml:"name"`
+	Wasm struct {
+		URL string `json:"url" yaml:"url"`
+	} `json:"wasm" yaml:"wasm"`
+}
+
+// paths are the files or directories of the queries and schema, written as a string or a list
+type paths []string
+
+func (p *paths) UnmarshalJSON(b []byte) error {
+	var path string
+	if err := json.Unmarshal(b, &path); err == nil {
+		*p = paths{path}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(p))
+}
+
+func (p *paths) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var path string
+	if err := unmarshal(&path); err == nil {
+		*p = paths{path}
+		return nil
+	}
+	return unmarshal((*[]string)(p))
+}
+
+type genConfig struct {
+	Go *goGenConfig `json:"go" yaml:"go"`
+}
+
+type goGenConfig struct {
+	Package                   string `json:"package" yaml:"package"`
+	Out                       string `json:"out" yaml:"out"`
+	SqlPackage                string `json:"sql_package" yaml:"sql_package"`
+	EmitInterface             bool   `json:"emit_interface" yaml:"emit_interface"`
+	EmitResultStructPointers  bool   `json:"emit_result_struct_pointers" yaml:"emit_result_struct_pointers"`
+	EmitParamsStructPointers  bool   `json:"emit_params_struct_pointers" yaml:"emit_params_struct_pointers"`
+	EmitMethodsWithDBArgument bool   `json:"emit_methods_with_db_argument" yaml:"emit_methods_with_db_argument"`
+}
+
+// typeConfig maps a Go type of the sqlc code to a proto type, with the expressions converting the values
+type typeConfig struct {
+	GoType      string   `json:"go_type" yaml:"go_type"`
+	ProtoType   string   `json:"proto_type" yaml:"proto_type"`
+	ProtoImport string   `json:"proto_import" yaml:"proto_import"`
+	GoImports   []string `json:"go_imports" yaml:"go_imports"`
+	ToProto     string   `json:"to_proto" yaml:"to_proto"`
+	ToGo        string   `json:"to_go" yaml:"to_go"`
+	ToGoError   bool     `json:"to_go_error" yaml:"to_go_error"`
+	DBType      string   `json:"db_type" yaml:"db_type"`
+	Nullable    bool     `json:"nullable" yaml:"nullable"`
+}
+
+type typesConfig struct {
+	Types []typeConfig `json:"types" yaml:"types"`
+}
+
+// readTypes reads the type mappings of a yaml or json file
+func readTypes(name string) ([]typeConfig, error) {
+	var cfg typesConfig
+	f, err := os.Open(name)
 	if err != nil {
-		return cfg, err
+		return nil, err
+	}
+	defer f.Close()
+
+	switch filepath.Ext(name) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&cfg)
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(f).Decode(&cfg)
+	default:
+		return nil, fmt.Errorf("invalid types file %q", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid types file %q: %w", name, err)
+	}
+	return cfg.Types, nil
+}
+
+func typeOverrides(types []typeConfig) []*metadata.TypeOverride {
+	res := make([]*metadata.TypeOverride, 0, len(types))
+	for _, t := range types {
+		res = append(res, &metadata.TypeOverride{
+			GoType:      t.GoType,
+			ProtoType:   t.ProtoType,
+			ProtoImport: t.ProtoImport,
+			GoImports:   t.GoImports,
+			ToProto:     t.ToProto,
+			ToGo:        t.ToGo,
+			ToGoError:   t.ToGoError,
+			DBType:      t.DBType,
+			Nullable:    t.Nullable,
+		})
+	}
+	return res
+}
+
+func readConfig(name string) (sqlcConfig, error) {
+	var cfg sqlcConfig
+	if name == "" {
+		var err error
+		name, err = configFile()
+		if err != nil {
+			return cfg, err
+		}
 	}
 
 	f, err := os.Open(name)
 	if err != nil {
-		panic(err)
+		return cfg, err
 	}
 	defer f.Close()
 
-	switch name {
-	case jsonConfig:
+	switch filepath.Ext(name) {
+	case ".json":
 		err = json.NewDecoder(f).Decode(&cfg)
-	case yamlConfig:
+	case ".yaml", ".yml":
 		err = yaml.NewDecoder(f).Decode(&cfg)
 	default:
 		return cfg, fmt.Errorf("invalid config file %q", name)
@@ -53,7 +180,26 @@ func readConfig() (sqlcConfig, error) {
 	if err != nil {
 		return cfg, err
 	}
-	for _, pkg := range cfg.Packages {
+
+	switch cfg.Version {
+	case "1", "":
+	case "2":
+		cfg.Packages = cfg.packagesV2()
+	default:
+		return cfg, fmt.Errorf("unsupported sqlc config version %q", cfg.Version)
+	}
+
+	// paths on the config file are relative to its directory
+	dir := filepath.Dir(name)
+	for i := range cfg.Packages {
+		pkg := &cfg.Packages[i]
+		pkg.Path = filepath.Join(dir, pkg.Path)
+		for j := range pkg.Queries {
+			pkg.Queries[j] = filepath.Join(dir, pkg.Queries[j])
+		}
+		for j := range pkg.Schema {
+			pkg.Schema[j] = filepath.Join(dir, pkg.Schema[j])
+		}
 		if pkg.Name == "" {
 			pkg.Name = filepath.Base(pkg.Path)
 		}
@@ -61,14 +207,86 @@ func readConfig() (sqlcConfig, error) {
 	return cfg, nil
 }
 
-func configFile() (string, error) {
-	if f, err := os.Stat(yamlConfig); err == nil && !f.IsDir() {
-		return yamlConfig, nil
+func (cfg sqlcConfig) packagesV2() []PackageConfig {
+	packages := make([]PackageConfig, 0)
+	for _, s := range cfg.SQL {
+		gen := s.Gen.Go
+		for i := 0; gen == nil && i < len(s.Codegen); i++ {
+			if c := s.Codegen[i]; cfg.isGoPlugin(c.Plugin) {
+				gen = &c.Options
+				gen.Out = c.Out
+			}
+		}
+		if gen == nil {
+			continue
+		}
+		packages = append(packages, PackageConfig{
+			Name:                      gen.Package,
+			Path:                      gen.Out,
+			Engine:                    s.Engine,
+			SqlPackage:                gen.SqlPackage,
+			EmitInterface:             gen.EmitInterface,
+			EmitResultStructPointers:  gen.EmitResultStructPointers,
+			EmitParamsStructPointers:  gen.EmitParamsStructPointers,
+			EmitMethodsWithDBArgument: gen.EmitMethodsWithDBArgument,
+			Queries:                   s.Queries,
+			Schema:                    s.Schema,
+		})
+	}
+	return packages
+}
+
+// isGoPlugin checks if the codegen plugin is sqlc-gen-go, which writes the same code of gen.go
+func (cfg sqlcConfig) isGoPlugin(name string) bool {
+	for _, p := range cfg.Plugins {
+		if p.Name == name {
+			return strings.Contains(p.Wasm.URL, "sqlc-gen-go")
+		}
+	}
+	return false
+}
+
+// outdatedSQL returns the queries and schema files modified after the sqlc code of the package.
+// sqlc-grpc reads the sqlc code, so the changes of these files are missing until sqlc generate runs.
+func (p PackageConfig) outdatedSQL() []string {
+	var generated time.Time
+	entries, err := os.ReadDir(p.Path)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".go" {
+			continue
+		}
+		if info, err := e.Info(); err == nil && info.ModTime().After(generated) {
+			generated = info.ModTime()
+		}
+	}
+	if generated.IsZero() {
+		return nil
 	}
 
-	if f, err := os.Stat(jsonConfig); err == nil && !f.IsDir() {
-		return jsonConfig, nil
+	res := make([]string, 0)
+	for _, path := range append(append([]string{}, p.Queries...), p.Schema...) {
+		filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			// sqlc reports the missing files
+			if err != nil || d.IsDir() || (name != path && filepath.Ext(name) != ".sql") {
+				return nil
+			}
+			if info, err := d.Info(); err == nil && info.ModTime().After(generated) {
+				res = append(res, name)
+			}
+			return nil
+		})
 	}
-	return "", errors.New("no sqlc config files (sqlc.json or sqlc.yaml)")
+	return res
+}
 
+func configFile() (string, error) {
+	for _, name := range configFiles {
+		if f, err := os.Stat(name); err == nil && !f.IsDir() {
+			return name, nil
+		}
+	}
+	return "", errors.New("no sqlc config files (sqlc.yaml, sqlc.yml or sqlc.json)")
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []PackageConfig
+		wantErr string
+	}{
+		{
+			name: "version 1",
+			file: "sqlc.yaml",
+			content: `version: "1"
+packages:
+  - path: "internal/books"
+    queries: "./sql/queries.sql"
+    schema: "./sql/schema.sql"
+    engine: "postgresql"
+    emit_interface: true
+`,
+			want: []PackageConfig{{Name: "books", Path: "internal/books", Engine: "postgresql", EmitInterface: true, Queries: paths{"sql/queries.sql"}, Schema: paths{"sql/schema.sql"}}},
+		},
+		{
+			name: "version 2",
+			file: "sqlc.yml",
+			content: `version: "2"
+sql:
+  - engine: "postgresql"
+    queries: "query.sql"
+    schema: ["schema.sql", "migrations"]
+    gen:
+      go:
+        package: "authors"
+        out: "internal/db"
+        sql_package: "pgx/v5"
+        emit_interface: true
+        emit_result_struct_pointers: true
+        emit_params_struct_pointers: true
+        emit_methods_with_db_argument: true
+`,
+			want: []PackageConfig{{
+				Name: "authors", Path: "internal/db", Engine: "postgresql", SqlPackage: "pgx/v5",
+				EmitInterface: true, EmitResultStructPointers: true, EmitParamsStructPointers: true, EmitMethodsWithDBArgument: true,
+				Queries: paths{"query.sql"}, Schema: paths{"schema.sql", "migrations"},
+			}},
+		},
+		{
+			name: "multiple sql entries",
+			file: "sqlc.json",
+			content: `{
+  "version": "2",
+  "sql": [
+    {"engine": "postgresql", "queries": "authors", "schema": "schema.sql", "gen": {"go": {"package": "authors", "out": "internal/authors"}}},
+    {"engine": "mysql", "queries": ["books"], "schema": "schema.sql", "gen": {"go": {"out": "internal/books"}}},
+    {"engine": "sqlite", "queries": "orders", "schema": "schema.sql", "codegen": [{"plugin": "grpc", "out": "."}]}
+  ]
+}`,
+			want: []PackageConfig{
+				{Name: "authors", Path: "internal/authors", Engine: "postgresql", Queries: paths{"authors"}, Schema: paths{"schema.sql"}},
+				{Name: "books", Path: "internal/books", Engine: "mysql", Queries: paths{"books"}, Schema: paths{"schema.sql"}},
+			},
+		},
+		{
+			name: "sqlc-gen-go plugin",
+			file: "sqlc.yaml",
+			content: `version: "2"
+plugins:
+  - name: golang
+    wasm:
+      url: "https://downloads.sqlc.dev/plugin/sqlc-gen-go_1.2.0.wasm"
+  - name: grpc
+    process:
+      cmd: sqlc-grpc
+sql:
+  - engine: "postgresql"
+    queries: "query.sql"
+    schema: "schema.sql"
+    codegen:
+      - plugin: grpc
+        out: "."
+        options:
+          path: "internal/db"
+      - plugin: golang
+        out: "internal/db"
+        options:
+          package: "db"
+          sql_package: "pgx/v5"
+          emit_interface: true
+`,
+			want: []PackageConfig{{Name: "db", Path: "internal/db", Engine: "postgresql", SqlPackage: "pgx/v5", EmitInterface: true, Queries: paths{"query.sql"}, Schema: paths{"schema.sql"}}},
+		},
+		{
+			name: "config on another directory",
+			file: filepath.Join("db", "sqlc.yaml"),
+			content: `version: "2"
+sql:
+  - engine: "postgresql"
+    queries: "sql/query.sql"
+    schema: "sql/schema.sql"
+    gen:
+      go:
+        out: "../internal/db"
+`,
+			want: []PackageConfig{{Name: "db", Path: "internal/db", Engine: "postgresql", Queries: paths{filepath.Join("db", "sql", "query.sql")}, Schema: paths{filepath.Join("db", "sql", "schema.sql")}}},
+		},
+		{
+			name:    "unsupported version",
+			file:    "sqlc.yaml",
+			content: `version: "3"`,
+			wantErr: "unsupported sqlc config version",
+		},
+		{
+			name:    "invalid extension",
+			file:    "sqlc.toml",
+			content: `version = "2"`,
+			wantErr: "invalid config file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, tt.file)
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(name, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := readConfig(name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the paths are relative to the config directory
+			for i := range tt.want {
+				want := &tt.want[i]
+				want.Path = filepath.Join(dir, want.Path)
+				for j := range want.Queries {
+					want.Queries[j] = filepath.Join(dir, want.Queries[j])
+				}
+				for j := range want.Schema {
+					want.Schema[j] = filepath.Join(dir, want.Schema[j])
+				}
+			}
+			if !reflect.DeepEqual(cfg.Packages, tt.want) {
+				t.Errorf("packages = %+v, want %+v", cfg.Packages, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{files: []string{"sqlc.yaml"}, want: "sqlc.yaml"},
+		{files: []string{"sqlc.yml"}, want: "sqlc.yml"},
+		{files: []string{"sqlc.json"}, want: "sqlc.json"},
+		{files: []string{"sqlc.json", "sqlc.yml"}, want: "sqlc.yml"},
+		{files: []string{"sqlc.toml"}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, f := range tt.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(`version: "2"`), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		got, err := configFile()
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("configFile() with %v = %q, want an error", tt.files, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("configFile() with %v = %q, %v, want %q", tt.files, got, err, tt.want)
+		}
+	}
+}
+
+func TestOutdatedSQL(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{"internal/db/queries.sql.go", "sql/schema.sql", "sql/queries/authors.sql", "sql/queries/books.sql", "sql/queries/README.md"}
+	for _, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generated := time.Now().Add(-time.Hour)
+	modified := map[string]time.Time{
+		"internal/db/queries.sql.go": generated,
+		"sql/schema.sql":             generated.Add(-time.Minute),
+		"sql/queries/authors.sql":    generated.Add(time.Minute),
+		"sql/queries/books.sql":      generated.Add(-time.Minute),
+	}
+	for f, mtime := range modified {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(f)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pkg := PackageConfig{
+		Path:    filepath.Join(dir, "internal", "db"),
+		Queries: paths{filepath.Join(dir, "sql", "queries"), filepath.Join(dir, "missing.sql")},
+		Schema:  paths{filepath.Join(dir, "sql", "schema.sql")},
+	}
+	want := []string{filepath.Join(dir, "sql", "queries", "authors.sql")}
+	if got := pkg.outdatedSQL(); !reflect.DeepEqual(got, want) {
+		t.Errorf("outdatedSQL() = %v, want %v", got, want)
+	}
+}
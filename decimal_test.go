@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+// decimalTest runs on a module with the rendered validation.Decimal, the template has no actions
+const decimalTest = `package validation
+
+import "testing"
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"12.50", "12.50"},
+		{"+12.50", "12.50"},
+		{"-12.50", "-12.50"},
+		{"007.5", "7.5"},
+		{"-000.12", "-0.12"},
+		{".5", "0.5"},
+		{"5.", "5"},
+		{"0", "0"},
+		{"1.5e3", "1500"},
+		{"1.5E+3", "1500"},
+		{"-1.5e-3", "-0.0015"},
+		{"12e-5", "0.00012"},
+		{"1.25e1", "12.5"},
+		{"1e0", "1"},
+	}
+	for _, tt := range tests {
+		got, err := Decimal(tt.value)
+		if err != nil {
+			t.Errorf("Decimal(%q) unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Decimal(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	for _, value := range []string{"", ".", "-", "NaN", "nan", "Infinity", "-Inf", "1e", "1.2.3", "--1", "1,5", " 1", "1e131073"} {
+		if got, err := Decimal(value); err == nil {
+			t.Errorf("Decimal(%q) = %q, want an error", value, got)
+		}
+	}
+}
+`
+
+func TestValidationDecimal(t *testing.T) {
+	src, err := fs.ReadFile(embeddedTemplates(), "internal/validation/decimal.go.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goTest(t, map[string]string{
+		"go.mod":          "module validation\n\ngo 1.19\n",
+		"decimal.go":      string(src),
+		"decimal_test.go": decimalTest,
+	})
+}
+
+// goTest runs go test on a temporary module with the files
+func goTest(t *testing.T, files map[string]string) {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goBin, "test", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+}
+
+// numericFixture is a plugin request with NUMERIC columns, that sqlc types as string and sql.NullString
+func numericFixture() *plugin.GenerateRequest {
+	column := func(name string, notNull bool) *plugin.Column {
+		return &plugin.Column{Name: name, NotNull: notNull, Type: &plugin.Identifier{Name: "numeric"}, Table: &plugin.Identifier{Name: "products"}}
+	}
+	id := &plugin.Column{Name: "id", NotNull: true, Type: &plugin.Identifier{Name: "bigint"}, Table: &plugin.Identifier{Name: "products"}}
+	return &plugin.GenerateRequest{
+		Settings: &plugin.Settings{Engine: "postgresql", Codegen: &plugin.Codegen{Out: "."}},
+		Catalog: &plugin.Catalog{DefaultSchema: "public", Schemas: []*plugin.Schema{{
+			Name:   "public",
+			Tables: []*plugin.Table{{Rel: &plugin.Identifier{Name: "products"}, Columns: []*plugin.Column{id, column("price", true), column("discount", false)}}},
+		}}},
+		Queries: []*plugin.Query{
+			{
+				Name: "GetPrice", Cmd: ":one", Text: "SELECT price, discount FROM products WHERE id = $1",
+				Columns: []*plugin.Column{column("price", true), column("discount", false)},
+				Params:  []*plugin.Parameter{{Number: 1, Column: id}},
+			},
+			{
+				Name: "SetPrice", Cmd: ":exec", Text: "UPDATE products SET price = $1, discount = $2 WHERE id = $3",
+				Params: []*plugin.Parameter{{Number: 1, Column: column("price", true)}, {Number: 2, Column: column("discount", false)}, {Number: 3, Column: id}},
+			},
+		},
+		PluginOptions: []byte(`{"module": "roundtrip", "path": "internal/db"}`),
+	}
+}
+
+// numericStubs replace the sqlc code, the protoc code and the dependencies of the generated adapters
+var numericStubs = map[string]string{
+	"go.mod": `module roundtrip
+
+go 1.19
+
+require (
+	go.uber.org/zap v1.0.0
+	google.golang.org/genproto v1.0.0
+)
+
+replace go.uber.org/zap => ./stubs/zap
+
+replace google.golang.org/genproto => ./stubs/genproto
+`,
+	"stubs/zap/go.mod": "module go.uber.org/zap\n\ngo 1.19\n",
+	"stubs/zap/zap.go": `package zap
+
+type Logger struct{}
+
+func (*Logger) Error(string, ...Field) {}
+
+type Field struct{}
+
+func Error(error) Field { return Field{} }
+`,
+	"stubs/genproto/go.mod": "module google.golang.org/genproto\n\ngo 1.19\n",
+	"stubs/genproto/googleapis/type/decimal/decimal.go": `package decimal
+
+type Decimal struct{ Value string }
+
+func (x *Decimal) GetValue() string {
+	if x == nil {
+		return ""
+	}
+	return x.Value
+}
+`,
+	"api/db/v1/db.pb.go": `package v1
+
+import decimalpb "google.golang.org/genproto/googleapis/type/decimal"
+
+type UnimplementedDbServiceServer struct{}
+
+type GetPriceRequest struct{ Id int64 }
+
+func (x *GetPriceRequest) GetId() int64 { return x.Id }
+
+type GetPriceResponse struct{ GetPriceRow *GetPriceRow }
+
+type GetPriceRow struct{ Price, Discount *decimalpb.Decimal }
+
+type SetPriceRequest struct {
+	Price, Discount *decimalpb.Decimal
+	Id              int64
+}
+
+func (x *SetPriceRequest) GetPrice() *decimalpb.Decimal    { return x.Price }
+func (x *SetPriceRequest) GetDiscount() *decimalpb.Decimal { return x.Discount }
+func (x *SetPriceRequest) GetId() int64                    { return x.Id }
+
+type SetPriceResponse struct{}
+`,
+	"internal/db/queries.go": `package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+type GetPriceRow struct {
+	Price    string
+	Discount sql.NullString
+}
+
+type SetPriceParams struct {
+	Price    string
+	Discount sql.NullString
+	ID       int64
+}
+
+type Queries struct{ row GetPriceRow }
+
+func (q *Queries) GetPrice(ctx context.Context, id int64) (GetPriceRow, error) {
+	return q.row, nil
+}
+
+func (q *Queries) SetPrice(ctx context.Context, arg SetPriceParams) error {
+	q.row = GetPriceRow{Price: arg.Price, Discount: arg.Discount}
+	return nil
+}
+`,
+	"internal/db/service_test.go": `package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	decimalpb "google.golang.org/genproto/googleapis/type/decimal"
+
+	pb "roundtrip/api/db/v1"
+	"roundtrip/internal/validation"
+)
+
+func TestDecimalRoundTrip(t *testing.T) {
+	s := &Service{logger: new(zap.Logger), querier: new(Queries)}
+	tests := []struct {
+		price, discount *decimalpb.Decimal
+		want            *pb.GetPriceRow
+	}{
+		{&decimalpb.Decimal{Value: "12.50"}, &decimalpb.Decimal{Value: "-1.5e-1"}, &pb.GetPriceRow{Price: &decimalpb.Decimal{Value: "12.50"}, Discount: &decimalpb.Decimal{Value: "-0.15"}}},
+		{&decimalpb.Decimal{Value: "007"}, nil, &pb.GetPriceRow{Price: &decimalpb.Decimal{Value: "7"}}},
+	}
+	for _, tt := range tests {
+		if _, err := s.SetPrice(context.Background(), &pb.SetPriceRequest{Price: tt.price, Discount: tt.discount, Id: 1}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := s.GetPrice(context.Background(), &pb.GetPriceRequest{Id: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := res.GetPriceRow
+		if got.Price.GetValue() != tt.want.Price.GetValue() || (got.Discount == nil) != (tt.want.Discount == nil) || got.Discount.GetValue() != tt.want.Discount.GetValue() {
+			t.Errorf("SetPrice(%v, %v) stored %v, want %v", tt.price, tt.discount, got, tt.want)
+		}
+	}
+
+	invalid := []*pb.SetPriceRequest{
+		{Price: &decimalpb.Decimal{Value: "1,5"}},
+		{Price: &decimalpb.Decimal{Value: "NaN"}},
+		{Price: &decimalpb.Decimal{Value: "1"}, Discount: &decimalpb.Decimal{Value: ""}},
+		{Discount: &decimalpb.Decimal{Value: "1"}},
+	}
+	for _, req := range invalid {
+		if _, err := s.SetPrice(context.Background(), req); !errors.Is(err, validation.ErrUserInput) {
+			t.Errorf("SetPrice(%v) error = %v, want validation.ErrUserInput", req, err)
+		}
+	}
+}
+`,
+}
+
+func TestPluginDecimalRoundTrip(t *testing.T) {
+	res, err := generate(context.Background(), numericFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for name, content := range numericStubs {
+		files[name] = content
+	}
+	for _, f := range res.Files {
+		switch name := filepath.ToSlash(f.Name); name {
+		case "internal/db/adapters.go", "internal/db/service.go", "internal/validation/validation.go", "internal/validation/decimal.go":
+			files[name] = string(f.Contents)
+		}
+	}
+	for _, name := range []string{"internal/db/adapters.go", "internal/db/service.go", "internal/validation/decimal.go"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("%s not generated", name)
+		}
+	}
+	goTest(t, files)
+}
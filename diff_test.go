@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{name: "empty"},
+		{name: "equal", a: []string{"a", "b"}, b: []string{"a", "b"}, want: " a b"},
+		{name: "insert only", b: []string{"a", "b"}, want: "+a+b"},
+		{name: "delete only", a: []string{"a", "b"}, want: "-a-b"},
+		{name: "insert", a: []string{"a", "c"}, b: []string{"a", "b", "c"}, want: " a+b c"},
+		{name: "delete", a: []string{"a", "b", "c"}, b: []string{"a", "c"}, want: " a-b c"},
+		{name: "replace", a: []string{"a", "b"}, b: []string{"a", "c"}, want: " a-b+c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			for _, op := range diffLines(tt.a, tt.b) {
+				got += string(op.kind) + op.line
+			}
+			if got != tt.want {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{name: "empty"},
+		{name: "equal", from: "a\nb\n", to: "a\nb\n"},
+		{
+			name: "insert only",
+			to:   "a\nb\n",
+			want: "--- from\n+++ to\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "delete only",
+			from: "a\nb\n",
+			want: "--- from\n+++ to\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "context",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- from\n+++ to\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("from", "to", []byte(tt.from), []byte(tt.to))
+			if got != tt.want {
+				t.Errorf("unifiedDiff(%q, %q) =\n%s\nwant\n%s", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
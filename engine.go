@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -22,144 +23,464 @@ import (
 //go:embed templates/*
 var templates embed.FS
 
-func process(def *metadata.Definition, outPath string, appendMode bool) error {
-	rootPath := "templates"
-	return fs.WalkDir(templates, rootPath, func(path string, d fs.DirEntry, err error) error {
+// packageTemplatesDir contains the templates rendered for each sqlc package
+const packageTemplatesDir = "package"
+
+// templateFiles are the embedded templates, overridden by the files of the -templates directory
+var templateFiles = embeddedTemplates()
+
+func embeddedTemplates() fs.FS {
+	sub, err := fs.Sub(templates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// overrideTemplates uses the files of dir instead of the embedded templates with the same relative path.
+// New files of dir are rendered like the embedded ones.
+func overrideTemplates(dir string) error {
+	if f, err := os.Stat(dir); err != nil {
+		return err
+	} else if !f.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+	templateFiles = overlayFS{base: embeddedTemplates(), overlay: os.DirFS(dir)}
+	return nil
+}
+
+// dumpTemplates writes the embedded templates to dir, as a starting point to customize them.
+// Existing files are kept.
+func dumpTemplates(dir string) error {
+	base := embeddedTemplates()
+	return fs.WalkDir(base, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Println("ERROR ", err.Error())
 			return err
 		}
+		dest := filepath.Join(dir, path)
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0750)
+		}
+		if fileExists(dest) {
+			fmt.Println("skipping existing file", dest)
+			return nil
+		}
+		content, err := fs.ReadFile(base, path)
+		if err != nil {
+			return err
+		}
+		fmt.Println(dest)
+		return ioutil.WriteFile(dest, content, 0644)
+	})
+}
 
-		newPath := strings.Replace(path, rootPath, outPath, 1)
-		newPath = strings.TrimSuffix(newPath, ".tmpl")
+// overlayFS looks for files on the overlay before the base
+type overlayFS struct {
+	base    fs.FS
+	overlay fs.FS
+}
 
-		if d.IsDir() {
-			if _, err := os.Stat(newPath); os.IsNotExist(err) {
-				err := os.MkdirAll(newPath, 0750)
-				if err != nil {
-					return err
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.overlay.Open(name); err == nil {
+		return f, nil
+	}
+	return o.base.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := make(map[string]fs.DirEntry)
+	baseEntries, baseErr := fs.ReadDir(o.base, name)
+	for _, e := range baseEntries {
+		entries[e.Name()] = e
+	}
+	overlayEntries, overlayErr := fs.ReadDir(o.overlay, name)
+	for _, e := range overlayEntries {
+		entries[e.Name()] = e
+	}
+	if baseErr != nil && overlayErr != nil {
+		return nil, baseErr
+	}
+	res := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name() < res[j].Name()
+	})
+	return res, nil
+}
+
+// generatedFile is the rendered content of a template and its destination path
+type generatedFile struct {
+	Path    string
+	Content []byte
+	// Skipped is true when an editable file already exists on append mode
+	Skipped bool
+}
+
+// templateErrors groups the errors of all templates that failed to render
+type templateErrors []error
+
+func (e templateErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func process(def *metadata.Definition, outPath string, appendMode bool) error {
+	files, err := render(def, outPath, appendMode, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return writeFiles(outPath, files)
+}
+
+// writeFiles stages all files in a temporary directory and only moves them into place after every one was written.
+// If a file can't be moved, the files already replaced are restored.
+func writeFiles(outPath string, files []generatedFile) error {
+	staging, err := ioutil.TempDir(outPath, ".sqlc-grpc-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	swaps := make([]fileSwap, 0, len(files))
+	for i, f := range files {
+		if f.Skipped {
+			continue
+		}
+		staged := filepath.Join(staging, fmt.Sprintf("%d.new", i))
+		if err := ioutil.WriteFile(staged, f.Content, 0644); err != nil {
+			return err
+		}
+		swaps = append(swaps, fileSwap{
+			staged: staged,
+			backup: filepath.Join(staging, fmt.Sprintf("%d.bkp", i)),
+			dest:   f.Path,
+		})
+	}
+
+	for i := range swaps {
+		if err := swaps[i].apply(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if rbErr := swaps[j].rollback(); rbErr != nil {
+					fmt.Println("[error] unable to restore", swaps[j].dest, rbErr.Error())
 				}
 			}
+			return err
+		}
+	}
+	return nil
+}
+
+// fileSwap replaces the dest file by the staged one, keeping a backup of the original
+type fileSwap struct {
+	staged  string
+	backup  string
+	dest    string
+	existed bool
+	// dirs are the directories created for dest, the deepest first
+	dirs []string
+}
+
+func (s *fileSwap) apply() error {
+	if err := s.mkdirAll(filepath.Dir(s.dest)); err != nil {
+		return err
+	}
+	if fileExists(s.dest) {
+		if err := os.Rename(s.dest, s.backup); err != nil {
+			return err
+		}
+		s.existed = true
+	}
+	if err := os.Rename(s.staged, s.dest); err != nil {
+		if s.existed {
+			os.Rename(s.backup, s.dest)
+		}
+		s.removeDirs()
+		return err
+	}
+	return nil
+}
+
+// mkdirAll creates dir and its missing parents, keeping them to be removed on rollback
+func (s *fileSwap) mkdirAll(dir string) error {
+	missing := make([]string, 0)
+	for d := dir; !fileExists(d); d = filepath.Dir(d) {
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	s.dirs = missing
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		s.removeDirs()
+		return err
+	}
+	return nil
+}
+
+// removeDirs removes the directories created by apply if they are empty
+func (s *fileSwap) removeDirs() error {
+	for _, dir := range s.dirs {
+		if err := os.Remove(dir); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSwap) rollback() error {
+	if !s.existed {
+		if err := os.Remove(s.dest); err != nil {
+			return err
+		}
+		return s.removeDirs()
+	}
+	return os.Rename(s.backup, s.dest)
+}
+
+// dryRun prints what process would do to each file, with the differences of the files to be created or overwritten.
+func dryRun(def *metadata.Definition, outPath string, appendMode bool) error {
+	files, err := render(def, outPath, appendMode, os.Stderr)
+	if err != nil {
+		return err
+	}
+	var diffs strings.Builder
+	for _, f := range files {
+		name := relativePath(outPath, f.Path)
+		if f.Skipped {
+			fmt.Printf("skip      %s (append mode)\n", name)
+			continue
+		}
+		current, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			fmt.Printf("create    %s\n", name)
+			diffs.WriteString(unifiedDiff("/dev/null", "b/"+name, nil, f.Content))
+			continue
+		}
+		if bytes.Equal(current, f.Content) {
+			fmt.Printf("unchanged %s\n", name)
+			continue
+		}
+		fmt.Printf("overwrite %s\n", name)
+		diffs.WriteString(unifiedDiff("a/"+name, "b/"+name, current, f.Content))
+	}
+	if diffs.Len() > 0 {
+		fmt.Println()
+		fmt.Print(diffs.String())
+	}
+	return nil
+}
+
+// check compares the rendered code that must not be edited (and the protocol buffers) with the files on disk.
+// It prints the differences in the unified format and returns false if any file is out of date.
+func check(def *metadata.Definition, outPath string) (bool, error) {
+	files, err := render(def, outPath, true, os.Stderr)
+	if err != nil {
+		return false, err
+	}
+	upToDate := true
+	for _, f := range files {
+		if f.Skipped || !strings.HasSuffix(f.Path, ".proto") && !doNotEdit(f.Content) {
+			continue
+		}
+		current, err := ioutil.ReadFile(f.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		if bytes.Equal(current, f.Content) {
+			continue
+		}
+		upToDate = false
+		name := relativePath(outPath, f.Path)
+		fmt.Print(unifiedDiff("a/"+name, "b/"+name, current, f.Content))
+	}
+	return upToDate, nil
+}
+
+// doNotEdit checks if the first line of the source has the "DO NOT EDIT" indication
+func doNotEdit(src []byte) bool {
+	firstLine := src
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		firstLine = src[:i]
+	}
+	return bytes.Contains(firstLine, []byte("DO NOT EDIT"))
+}
+
+func relativePath(basePath, path string) string {
+	if rel, err := filepath.Rel(basePath, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// render executes the templates, printing their progress on log
+func render(def *metadata.Definition, outPath string, appendMode bool, log io.Writer) ([]generatedFile, error) {
+	files := make([]generatedFile, 0)
+	var errs templateErrors
+	err := fs.WalkDir(templateFiles, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintln(log, "ERROR ", err.Error())
+			return err
+		}
+
+		if d.IsDir() {
 			return nil
 		}
 
-		fmt.Println(path, "...")
+		newPath := strings.TrimSuffix(filepath.Join(outPath, path), ".tmpl")
 
-		in, err := templates.Open(path)
+		fmt.Fprintln(log, path, "...")
+
+		tpl, err := fs.ReadFile(templateFiles, path)
 		if err != nil {
 			return err
 		}
-		defer in.Close()
 
 		if strings.HasSuffix(newPath, "service.proto") {
 			dir := strings.TrimSuffix(newPath, "service.proto")
-			tpl, err := ioutil.ReadAll(in)
-			if err != nil {
-				return err
-			}
 			for _, pkg := range def.Packages {
 				dest := filepath.Join(dir, metadata.ToSnakeCase(pkg.Package), "v1")
-				if _, err := os.Stat(dest); os.IsNotExist(err) {
-					err := os.MkdirAll(dest, 0750)
-					if err != nil {
-						return err
-					}
-				}
 				destFile := filepath.Join(dest, (metadata.ToSnakeCase(pkg.Package) + ".proto"))
 				if appendMode && fileExists(destFile) {
 					pkg.LoadOptions(destFile)
 				}
 
-				err = genFromTemplate(path, string(tpl), pkg, false, destFile)
+				src, err := genFromTemplate(path, string(tpl), pkg, false)
 				if err != nil {
-					return err
+					errs = append(errs, fmt.Errorf("%s (package %s): %w", path, pkg.Package, err))
+					continue
 				}
+				files = append(files, generatedFile{Path: destFile, Content: src})
 			}
 			return nil
 		}
 
-		if strings.HasSuffix(newPath, "service.go") {
-			tpl, err := ioutil.ReadAll(in)
-			if err != nil {
-				return err
-			}
+		// templates on the package directory are rendered for each sqlc package
+		if strings.HasPrefix(path, packageTemplatesDir+"/") {
+			name := strings.TrimSuffix(strings.TrimPrefix(path, packageTemplatesDir+"/"), ".tmpl")
 			for _, pkg := range def.Packages {
-				err = genFromTemplate(path, string(tpl), pkg, true, filepath.Join(pkg.SrcPath, "service.go"))
-				if err != nil {
-					return err
+				if name == "adapters.go" && len(pkg.OutputAdapters) == 0 && len(pkg.Enums) == 0 {
+					continue
 				}
-			}
-			return nil
-		}
-
-		if strings.HasSuffix(newPath, "service.factory.go") {
-			tpl, err := ioutil.ReadAll(in)
-			if err != nil {
-				return err
-			}
-			for _, pkg := range def.Packages {
-				newPath := filepath.Join(pkg.SrcPath, "service.factory.go")
-				if appendMode && fileExists(newPath) {
-					return nil
+				if name == "iterators.go" && !pkg.HasServerStreaming() {
+					continue
+				}
+				newPath := filepath.Join(pkg.SrcPath, name)
+				if !strings.HasSuffix(path, ".tmpl") {
+					files = append(files, staticFile(newPath, tpl, appendMode))
+					continue
 				}
-				err = genFromTemplate(path, string(tpl), pkg, true, newPath)
+				goCode := strings.HasSuffix(newPath, ".go")
+				if goCode && appendMode && fileExists(newPath) && !doNotEdit(tpl) {
+					files = append(files, generatedFile{Path: newPath, Skipped: true})
+					continue
+				}
+				src, err := genFromTemplate(path, string(tpl), pkg, goCode)
 				if err != nil {
-					return err
+					errs = append(errs, fmt.Errorf("%s (package %s): %w", path, pkg.Package, err))
+					continue
 				}
+				files = append(files, generatedFile{Path: newPath, Content: src})
 			}
 			return nil
 		}
 
-		if strings.HasSuffix(newPath, "adapters.go") {
-			tpl, err := ioutil.ReadAll(in)
-			if err != nil {
-				return err
+		if strings.HasSuffix(path, ".tmpl") {
+			if skipTemplate(def, path) {
+				return nil
 			}
-			for _, pkg := range def.Packages {
-				if len(pkg.OutputAdapters) > 0 {
-					err = genFromTemplate(path, string(tpl), pkg, true, filepath.Join(pkg.SrcPath, "adapters.go"))
-					if err != nil {
-						return err
-					}
+			goCode := strings.HasSuffix(newPath, ".go")
+			if goCode && appendMode && fileExists(newPath) && !doNotEdit(tpl) {
+				if hint := keptFileWarning(def, path, newPath); hint != "" {
+					fmt.Fprintf(log, "[warning] %s: %s\n", relativePath(outPath, newPath), hint)
 				}
+				files = append(files, generatedFile{Path: newPath, Skipped: true})
+				return nil
 			}
-			return nil
-		}
-
-		if strings.HasSuffix(path, ".tmpl") {
-			tpl, err := ioutil.ReadAll(in)
+			src, err := genFromTemplate(path, string(tpl), def, goCode)
 			if err != nil {
-				return err
-			}
-			goCode := strings.HasSuffix(newPath, ".go")
-			if goCode && appendMode && fileExists(newPath) && !strings.HasSuffix(newPath, "registry.go") {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
 				return nil
 			}
-			return genFromTemplate(path, string(tpl), def, goCode, newPath)
-		}
-
-		if appendMode && fileExists(newPath) {
+			files = append(files, generatedFile{Path: newPath, Content: src})
 			return nil
 		}
 
-		out, err := os.Create(newPath)
-		if err != nil {
-			return err
-		}
-		defer out.Close()
-
-		_, err = io.Copy(out, in)
-		return err
+		files = append(files, staticFile(newPath, tpl, appendMode))
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return files, nil
 }
 
-func genFromTemplate(name, tmp string, data interface{}, goSource bool, outPath string) error {
-	w, err := os.Create(outPath)
-	if err != nil {
-		return err
+// skipTemplate checks if the template isn't used by the packages, like the pgx tracer without a pgx datasource
+func skipTemplate(def *metadata.Definition, path string) bool {
+	switch path {
+	case "internal/server/trace/pgx.go.tmpl":
+		return def.SqlPackage() == ""
+	case "internal/pagination/pagination.go.tmpl":
+		return !def.HasPagination()
+	case "internal/fieldmask/fieldmask.go.tmpl":
+		return !def.HasFieldMask()
+	case "internal/server/auth.go.tmpl":
+		return !def.HasAuth()
+	case "internal/validation/decimal.go.tmpl":
+		return !def.HasDecimal()
+	}
+	return false
+}
+
+// keptFileWarning checks if an editable file kept on append mode works with the regenerated files.
+// It returns the manual edit required, like the registration of a new interceptor.
+func keptFileWarning(def *metadata.Definition, path, newPath string) string {
+	var snippet, hint string
+	switch path {
+	case "internal/server/config.go.tmpl":
+		if !def.HasAuth() {
+			return ""
+		}
+		snippet, hint = "authUnaryInterceptor", "append authUnaryInterceptor and authStreamInterceptor to the interceptors of grpcOpts to enforce the auth directives"
+	case "main.go.tmpl":
+		args := []string{"log"}
+		for _, ds := range def.Datasources() {
+			args = append(args, ds.Var())
+		}
+		snippet = fmt.Sprintf("registerServer(%s)", strings.Join(args, ", "))
+		hint = fmt.Sprintf("open the connections of the datasources and call %s, the registry expects them", snippet)
+	default:
+		return ""
+	}
+	content, err := ioutil.ReadFile(newPath)
+	if err != nil || bytes.Contains(content, []byte(snippet)) {
+		return ""
+	}
+	return hint
+}
+
+// staticFile is a file copied as is, it isn't rewritten on append mode
+func staticFile(path string, content []byte, appendMode bool) generatedFile {
+	if appendMode && fileExists(path) {
+		return generatedFile{Path: path, Skipped: true}
 	}
-	defer w.Close()
+	return generatedFile{Path: path, Content: content}
+}
 
+func genFromTemplate(name, tmp string, data interface{}, goSource bool) ([]byte, error) {
 	var b bytes.Buffer
 
 	funcMap := template.FuncMap{
@@ -169,31 +490,27 @@ func genFromTemplate(name, tmp string, data interface{}, goSource bool, outPath
 
 	t, err := template.New(name).Funcs(funcMap).Parse(tmp)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	err = t.Execute(&b, data)
 	if err != nil {
-		return fmt.Errorf("execute template error: %w", err)
+		return nil, fmt.Errorf("execute template error: %w", err)
 	}
 
-	var src []byte
-	if goSource {
-		src, err = format.Source(b.Bytes())
-		if err != nil {
-			fmt.Println(b.String())
-			return fmt.Errorf("format source error: %w", err)
-		}
-		src, err = imports.Process("", src, nil)
-		if err != nil {
-			return fmt.Errorf("organize imports error: %w", err)
-		}
-	} else {
-		src = b.Bytes()
+	if !goSource {
+		return b.Bytes(), nil
 	}
 
-	fmt.Fprintf(w, "%s", string(src))
-	return nil
-
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		fmt.Println(b.String())
+		return nil, fmt.Errorf("format source error: %w", err)
+	}
+	src, err = imports.Process("", src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("organize imports error: %w", err)
+	}
+	return src, nil
 }
 
 func fileExists(path string) bool {
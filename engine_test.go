@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/walterwanderley/sqlc-grpc/metadata"
+)
+
+// booktestDefinition parses the sqlc package of the booktest example
+func booktestDefinition(t *testing.T) *metadata.Definition {
+	t.Helper()
+	pkg, err := metadata.ParsePackage(metadata.PackageOpts{
+		Path:   filepath.Join("_examples", "booktest", "internal", "books"),
+		Engine: "postgresql",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.GoModule = "booktest"
+	return &metadata.Definition{
+		Args:     "-m booktest",
+		GoModule: "booktest",
+		Packages: []*metadata.Package{pkg},
+	}
+}
+
+func renderedFile(t *testing.T, files []generatedFile, name string) []byte {
+	t.Helper()
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, name) {
+			return f.Content
+		}
+	}
+	t.Fatalf("%s not rendered", name)
+	return nil
+}
+
+func TestRenderKeepsHandEditedRoutes(t *testing.T) {
+	out := t.TempDir()
+	files, err := render(booktestDefinition(t), out, false, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoFile := filepath.Join(out, "proto", "books", "v1", "books.proto")
+	src := string(renderedFile(t, files, protoFile))
+	route := `get: "/books-by-tags"`
+	if !strings.Contains(src, route) {
+		t.Fatalf("route %s not generated:\n%s", route, src)
+	}
+	edited := `post: "/v2/books:searchTags"`
+	src = strings.Replace(src, route, edited+"\n            body: \"*\"", 1)
+	if err := os.MkdirAll(filepath.Dir(protoFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(protoFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = render(booktestDefinition(t), out, true, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(renderedFile(t, files, protoFile))
+	if !strings.Contains(got, edited) || strings.Contains(got, route) {
+		t.Errorf("the hand-edited route was replaced:\n%s", got)
+	}
+}
+
+func TestWriteFilesRollback(t *testing.T) {
+	out := t.TempDir()
+	existing := filepath.Join(out, "main.go")
+	if err := ioutil.WriteFile(existing, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a file where a directory is expected makes the last move fail
+	blocker := filepath.Join(out, "api")
+	if err := ioutil.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []generatedFile{
+		{Path: existing, Content: []byte("package main\n\nfunc main() {}\n")},
+		{Path: filepath.Join(out, "internal", "books", "service.go"), Content: []byte("package books\n")},
+		{Path: filepath.Join(out, "api", "books", "v1", "books.pb.go"), Content: []byte("package v1\n")},
+	}
+	if err := writeFiles(out, files); err == nil {
+		t.Fatal("writeFiles() with a blocked directory should fail")
+	}
+
+	src, err := ioutil.ReadFile(existing)
+	if err != nil || string(src) != "package main\n" {
+		t.Errorf("main.go = %q, %v, want the original content", src, err)
+	}
+	entries, err := ioutil.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"api", "main.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("files after the rollback = %v, want %v", names, want)
+	}
+}
@@ -1,11 +1,23 @@
 module github.com/walterwanderley/sqlc-grpc
 
-go 1.16
+go 1.19
 
 require (
 	github.com/emicklei/proto v1.9.2
 	github.com/gogo/protobuf v1.3.2
-	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3
-	golang.org/x/tools v0.1.10
+	github.com/jinzhu/inflection v1.0.0
+	github.com/sqlc-dev/plugin-sdk-go v1.23.0
+	golang.org/x/mod v0.11.0
+	golang.org/x/tools v0.10.0
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.14.0 // indirect
+	golang.org/x/sys v0.11.0 // indirect
+	golang.org/x/text v0.12.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230822172742-b8732ec3820d // indirect
+	google.golang.org/grpc v1.59.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
@@ -6,8 +6,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -18,18 +16,57 @@ import (
 
 var (
 	module        string
+	configPath    string
 	ignoreQueries string
+	streamQueries string
+	batchSize     int
+	zeroRows      bool
+	pageSize      int
+	fieldMask     bool
+	resourceMode  bool
+	datasources   string
+	typesPath     string
 	appendMode    bool
+	checkMode     bool
+	dryRunMode    bool
+	skipPost      bool
+	postSteps     string
+	offline       bool
+	bufCache      string
+	templatesDir  string
+	dumpDir       string
 	showVersion   bool
 	help          bool
 )
 
 func main() {
+	if isPluginCall() {
+		runPlugin()
+		return
+	}
+
 	flag.BoolVar(&help, "h", false, "Help for this program")
 	flag.BoolVar(&showVersion, "v", false, "Show version")
 	flag.BoolVar(&appendMode, "append", false, "Enable append mode. Don't rewrite editable files")
+	flag.BoolVar(&dryRunMode, "dry-run", false, "List the files that would be created, overwritten or skipped, with the differences. Nothing is written")
+	flag.BoolVar(&checkMode, "check", false, "Check if the generated code is up to date, printing the differences. Nothing is written")
 	flag.StringVar(&module, "m", "my-project", "Go module name if there are no go.mod")
+	flag.StringVar(&configPath, "f", "", "Path to the sqlc config file (default sqlc.yaml, sqlc.yml or sqlc.json)")
 	flag.StringVar(&ignoreQueries, "i", "", "Comma separated list (regex) of queries to ignore")
+	flag.StringVar(&streamQueries, "stream", "", "Comma separated list (regex) of :many queries to generate as server-streaming RPCs. Use \".*\" for all of them")
+	flag.IntVar(&batchSize, "copyfrom-batch-size", 1000, "Maximum number of rows sent to each :copyfrom call by the client-streaming RPCs and of items sent to each :batch call")
+	flag.BoolVar(&zeroRows, "zero-rows-not-found", false, "Return NotFound when an UPDATE or DELETE :execrows/:execresult query affects no rows")
+	flag.IntVar(&pageSize, "max-page-size", 100, "Maximum page_size of the paginated list RPCs (:many queries with LIMIT and OFFSET params)")
+	flag.BoolVar(&fieldMask, "field-mask", false, "Generate the UPDATE queries with a matching Get query as PATCH methods with an update_mask (google.protobuf.FieldMask)")
+	flag.BoolVar(&resourceMode, "resource", false, "Generate a resource-oriented HTTP API, grouping the queries by table into collections (AIP-121)")
+	flag.StringVar(&datasources, "datasources", "", "Comma separated list of package=name to share or split the database connections (default one per engine)")
+	flag.StringVar(&typesPath, "types", "", "Path to a yaml or json file mapping Go types to proto types, with the expressions converting the values")
+	flag.StringVar(&templatesDir, "templates", "", "Directory with templates to override the embedded ones (same relative path) or to add new ones")
+	flag.StringVar(&dumpDir, "dump-templates", "", "Write the embedded templates to the directory and exit")
+	flag.BoolVar(&skipPost, "skip-post", false, "Skip the post processing (go mod, tools installation and buf)")
+	flag.StringVar(&postSteps, "post", strings.Join(allPostSteps, ","), "Comma separated list of post processing steps to execute")
+	flag.BoolVar(&offline, "offline", false, "Air-gapped post processing. Use the tools on PATH and the buf module cache, without network access")
+	flag.StringVar(&bufCache, "buf-cache", "", "Path to a vendored buf module cache (BUF_CACHE_DIR)")
 	flag.Parse()
 
 	if help {
@@ -43,7 +80,20 @@ func main() {
 		return
 	}
 
-	cfg, err := readConfig()
+	if dumpDir != "" {
+		if err := dumpTemplates(dumpDir); err != nil {
+			log.Fatal("unable to dump templates:", err.Error())
+		}
+		return
+	}
+
+	if templatesDir != "" {
+		if err := overrideTemplates(templatesDir); err != nil {
+			log.Fatal("invalid templates directory:", err.Error())
+		}
+	}
+
+	cfg, err := readConfig(configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -52,13 +102,22 @@ func main() {
 		log.Fatal("no packages")
 	}
 
-	queriesToIgnore := make([]*regexp.Regexp, 0)
-	for _, queryName := range strings.Split(ignoreQueries, ",") {
-		s := strings.TrimSpace(queryName)
-		if s == "" {
-			continue
+	var overrides []*metadata.TypeOverride
+	if typesPath != "" {
+		types, err := readTypes(typesPath)
+		if err != nil {
+			log.Fatal(err)
 		}
-		queriesToIgnore = append(queriesToIgnore, regexp.MustCompile(s))
+		overrides = typeOverrides(types)
+	}
+
+	queriesToIgnore, err := queriesRegex(ignoreQueries)
+	if err != nil {
+		log.Fatal("invalid -i option: ", err)
+	}
+	serverStreaming, err := queriesRegex(streamQueries)
+	if err != nil {
+		log.Fatal("invalid -stream option: ", err)
 	}
 
 	if m := moduleFromGoMod(); m != "" {
@@ -66,10 +125,7 @@ func main() {
 		module = m
 	}
 
-	args := strings.Join(os.Args, " ")
-	if !strings.Contains(args, " -append") {
-		args += " -append"
-	}
+	args := generateArgs()
 
 	def := metadata.Definition{
 		Args:     args,
@@ -78,18 +134,29 @@ func main() {
 	}
 
 	for _, p := range cfg.Packages {
+		if files := p.outdatedSQL(); len(files) > 0 {
+			fmt.Printf("[warning] %s changed after the sqlc code of %s, run sqlc generate first\n", strings.Join(files, ", "), p.Path)
+		}
 		pkg, err := metadata.ParsePackage(metadata.PackageOpts{
 			Path:               p.Path,
+			Engine:             p.Engine,
+			SqlPackage:         p.SqlPackage,
 			EmitInterface:      p.EmitInterface,
 			EmitParamsPointers: p.EmitParamsStructPointers,
 			EmitResultPointers: p.EmitResultStructPointers,
 			EmitDbArgument:     p.EmitMethodsWithDBArgument,
+			ServerStreaming:    serverStreaming,
+			CopyFromBatchSize:  batchSize,
+			ZeroRowsNotFound:   zeroRows,
+			MaxPageSize:        pageSize,
+			FieldMask:          fieldMask,
+			Resource:           resourceMode,
+			TypeOverrides:      overrides,
 		}, queriesToIgnore)
 		if err != nil {
 			log.Fatal("parser error:", err.Error())
 		}
 		pkg.GoModule = module
-		pkg.Engine = p.Engine
 
 		if len(pkg.Services) == 0 {
 			log.Println("No services on package", pkg.Package)
@@ -106,17 +173,89 @@ func main() {
 		log.Fatal("No services found, verify the -i parameter")
 	}
 
+	names, err := datasourceNames(datasources)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := def.SetDatasources(names); err != nil {
+		log.Fatal(err)
+	}
+
 	wd, err := os.Getwd()
 	if err != nil {
 		log.Fatal("unable to get working directory:", err.Error())
 	}
 
+	if checkMode {
+		upToDate, err := check(&def, wd)
+		if err != nil {
+			log.Fatal("unable to check templates:", err.Error())
+		}
+		if !upToDate {
+			fmt.Println("The generated code is out of date, please execute: go generate")
+			os.Exit(1)
+		}
+		fmt.Println("The generated code is up to date")
+		return
+	}
+
+	if dryRunMode {
+		if err := dryRun(&def, wd, appendMode); err != nil {
+			log.Fatal("unable to process templates:", err.Error())
+		}
+		return
+	}
+
 	err = process(&def, wd, appendMode)
 	if err != nil {
 		log.Fatal("unable to process templates:", err.Error())
 	}
 
-	postProcess(&def, wd)
+	if skipPost {
+		return
+	}
+
+	steps, err := parsePostSteps(postSteps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := postProcess(&def, wd, postOptions{steps: steps, offline: offline, bufCache: bufCache}); err != nil {
+		log.Fatal("post processing error: ", err.Error())
+	}
+}
+
+// generateArgs returns the command line to regenerate the code on append mode
+func generateArgs() string {
+	args := make([]string, 0, len(os.Args)+1)
+	for _, arg := range os.Args {
+		switch strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-") {
+		case "check", "dry-run":
+			continue
+		}
+		args = append(args, arg)
+	}
+	res := strings.Join(args, " ")
+	if !strings.Contains(res, " -append") {
+		res += " -append"
+	}
+	return res
+}
+
+// datasourceNames parses the -datasources list, like books=catalog,authors=catalog
+func datasourceNames(list string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pkg, name, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(pkg) == "" || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid datasource %q, use package=name", item)
+		}
+		res[strings.TrimSpace(pkg)] = strings.TrimSpace(name)
+	}
+	return res, nil
 }
 
 func moduleFromGoMod() string {
@@ -133,36 +272,3 @@ func moduleFromGoMod() string {
 
 	return modfile.ModulePath(b)
 }
-
-func postProcess(def *metadata.Definition, workingDirectory string) {
-	fmt.Printf("Configuring project %s...\n", def.GoModule)
-	execCommand("go mod init " + def.GoModule)
-	execCommand("go mod tidy -go=1.16")
-	execCommand("go install github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway " +
-		"github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2 " +
-		"google.golang.org/protobuf/cmd/protoc-gen-go " +
-		"google.golang.org/grpc/cmd/protoc-gen-go-grpc " +
-		"github.com/bufbuild/buf/cmd/buf")
-	fmt.Println("Compiling protocol buffers...")
-	if err := os.Chdir("proto"); err != nil {
-		panic(err)
-	}
-	execCommand("buf mod update")
-	if err := os.Chdir(workingDirectory); err != nil {
-		panic(err)
-	}
-	execCommand("buf generate")
-	execCommand("go mod tidy -go=1.16")
-	fmt.Println("Finished!")
-}
-
-func execCommand(command string) error {
-	line := strings.Split(command, " ")
-	cmd := exec.Command(line[0], line[1:]...)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("[error] %q: %w", command, err)
-	}
-	return nil
-}
@@ -2,12 +2,13 @@ package metadata
 
 import (
 	"go/ast"
+	"go/token"
 	"strings"
 )
 
-func visitFunc(fun *ast.FuncDecl, def *Package, constants map[string]string) {
+func visitFunc(fset *token.FileSet, fun *ast.FuncDecl, def *Package, constants, batchResults map[string]string) error {
 	if !isMethodValid(fun) {
-		return
+		return nil
 	}
 
 	inputNames := make([]string, 0)
@@ -19,7 +20,7 @@ func visitFunc(fun *ast.FuncDecl, def *Package, constants map[string]string) {
 		for _, n := range p.Names {
 			typ, err := exprToStr(p.Type)
 			if err != nil {
-				return
+				return nil
 			}
 			if typ == "DBTX" {
 				continue
@@ -30,57 +31,31 @@ func visitFunc(fun *ast.FuncDecl, def *Package, constants map[string]string) {
 	}
 
 	var output string
-	// two is the maximum results for a valid method, error is the last result
-	if len(fun.Type.Results.List) > 1 {
+	if results, ok := isBatchMethod(fun); ok {
+		if len(inputTypes) != 1 || !strings.HasPrefix(inputTypes[0], "[]") {
+			return nil
+		}
+		output = batchResults[results]
+	} else if len(fun.Type.Results.List) > 1 {
+		// two is the maximum results for a valid method, error is the last result
 		p := fun.Type.Results.List[0]
 		var err error
 		output, err = exprToStr(p.Type)
 		if err != nil {
-			return
+			return nil
 		}
 	}
-	service := Service{
-		Name:       fun.Name.String(),
-		InputNames: inputNames,
-		InputTypes: inputTypes,
-		Output:     output,
-		Sql:        constants[fun.Name.String()],
-		Messages:   def.Messages,
-	}
-	def.Services = append(def.Services, &service)
-
-	if !service.HasCustomParams() {
-		reqMessageName := fun.Name.String() + "Params"
-		if _, ok := def.Messages[reqMessageName]; !ok {
-			fields := make([]*Field, 0)
-			for i, name := range service.InputNames {
-				fields = append(fields, &Field{Name: name, Type: service.InputTypes[i]})
-			}
-			def.Messages[reqMessageName] = &Message{
-				Name:   reqMessageName,
-				Fields: fields,
-			}
-		}
+	var iterator string
+	if strings.HasPrefix(output, "[]") {
+		iterator = iteratorBody(fset, fun)
 	}
-
-	resMessageName := fun.Name.String() + "Response"
-	if _, ok := def.Messages[resMessageName]; !ok {
-		fields := make([]*Field, 0)
-		if !service.EmptyOutput() {
-
-			name := "value"
-			if service.HasArrayOutput() {
-				name = "list"
-			} else if service.HasCustomOutput() {
-				name = ToSnakeCase(canonicalName(service.Output))
-			}
-			fields = append(fields, &Field{Name: name, Type: toProtoType(service.Output)})
-		}
-		def.Messages[resMessageName] = &Message{
-			Name:   resMessageName,
-			Fields: fields,
+	var comments []string
+	if fun.Doc != nil {
+		for _, c := range fun.Doc.List {
+			comments = append(comments, c.Text)
 		}
 	}
+	return def.addService(fun.Name.String(), inputNames, inputTypes, output, constants[fun.Name.String()], iterator, comments)
 }
 
 func isMethodValid(fun *ast.FuncDecl) bool {
@@ -124,6 +99,10 @@ func isMethodValid(fun *ast.FuncDecl) bool {
 		return false
 	}
 
+	if _, ok := isBatchMethod(fun); ok {
+		return true
+	}
+
 	if len(fun.Type.Results.List) > 2 {
 		return false
 	}
@@ -140,6 +119,49 @@ func isMethodValid(fun *ast.FuncDecl) bool {
 	return true
 }
 
+// isBatchMethod checks for the pgx batch methods, which return only a *<Query>BatchResults
+func isBatchMethod(fun *ast.FuncDecl) (string, bool) {
+	if len(fun.Type.Results.List) != 1 {
+		return "", false
+	}
+	typ, err := exprToStr(fun.Type.Results.List[0].Type)
+	if err != nil || typ != "*"+fun.Name.String()+"BatchResults" {
+		return "", false
+	}
+	return typ[1:], true
+}
+
+// addBatchResults maps the *<Query>BatchResults types to the Go type of the items received by their callbacks:
+// the row of QueryRow, the rows of Query and nothing for Exec.
+func addBatchResults(batchResults map[string]string, file *ast.File) {
+	for _, decl := range file.Decls {
+		fun, ok := decl.(*ast.FuncDecl)
+		if !ok || fun.Recv == nil || len(fun.Recv.List) != 1 || len(fun.Type.Params.List) != 1 {
+			continue
+		}
+		recv, err := exprToStr(fun.Recv.List[0].Type)
+		if err != nil || !strings.HasSuffix(recv, "BatchResults") {
+			continue
+		}
+		callback, ok := fun.Type.Params.List[0].Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		switch fun.Name.Name {
+		case "Exec":
+			batchResults[recv[1:]] = ""
+		case "QueryRow", "Query":
+			// func(int, T, error)
+			if len(callback.Params.List) != 3 {
+				continue
+			}
+			if typ, err := exprToStr(callback.Params.List[1].Type); err == nil {
+				batchResults[recv[1:]] = typ
+			}
+		}
+	}
+}
+
 func canonicalName(typ string) string {
 	name := strings.TrimPrefix(typ, "[]")
 	name = strings.TrimPrefix(name, "*")
@@ -32,24 +32,58 @@ func exprToStr(e ast.Expr) (string, error) {
 			return "", err
 		}
 		return "[]" + elt, nil
+	case *ast.InterfaceType:
+		// sqlc uses interface{} on the columns without a type, like the SQLite expressions
+		if exp.Methods == nil || len(exp.Methods.List) == 0 {
+			return "interface{}", nil
+		}
+		return "", fmt.Errorf("invalid type %T - %v", exp, exp)
 	default:
 		return "", fmt.Errorf("invalid type %T - %v", exp, exp)
 	}
 }
 
-func toProtoType(typ string) string {
+// the NUMERIC and DECIMAL columns that sqlc types as string or sql.NullString on plugin mode, converted to google.type.Decimal
+const (
+	numericString     = "numeric.String"
+	numericNullString = "numeric.NullString"
+)
+
+// goType returns the type of the sqlc code, like string for a NUMERIC column
+func goType(typ string) string {
+	switch typ {
+	case numericString:
+		return "string"
+	case numericNullString:
+		return "sql.NullString"
+	}
+	return typ
+}
+
+func toProtoType(typ string, overrides *typeOverrides) string {
+	if o, ok := overrides.get(typ); ok {
+		return o.ProtoType
+	}
+	if typ == "*netip.Addr" || typ == "*netip.Prefix" {
+		// the nullable inet and cidr of pgx/v5
+		return "google.protobuf.StringValue"
+	}
 	if strings.HasPrefix(typ, "*") {
-		return toProtoType(typ[1:])
+		return toProtoType(typ[1:], overrides)
 	}
 	if strings.HasPrefix(typ, "[]") && typ != "[]byte" {
-		return "repeated " + toProtoType(typ[2:])
+		return "repeated " + toProtoType(typ[2:], overrides)
+	}
+	if strings.HasPrefix(strings.TrimPrefix(typ, "repeated "), "google.") {
+		// already converted, like the fields of the responses
+		return typ
 	}
 	switch typ {
 	case "json.RawMessage", "[]byte":
 		return "bytes"
-	case "sql.NullBool":
+	case "sql.NullBool", "pgtype.Bool":
 		return "google.protobuf.BoolValue"
-	case "sql.NullInt32":
+	case "sql.NullInt32", "pgtype.Int4", "pgtype.Int2":
 		return "google.protobuf.Int32Value"
 	case "int":
 		return "int64"
@@ -57,67 +91,145 @@ func toProtoType(typ string) string {
 		return "int32"
 	case "uint16":
 		return "uint32"
-	case "sql.NullInt64":
+	case "sql.NullInt64", "pgtype.Int8":
 		return "google.protobuf.Int64Value"
 	case "float32":
 		return "float"
 	case "float64":
 		return "double"
-	case "sql.NullFloat64":
+	case "sql.NullFloat64", "pgtype.Float8":
 		return "google.protobuf.DoubleValue"
-	case "sql.NullString":
+	case "pgtype.Float4":
+		return "google.protobuf.FloatValue"
+	case "sql.NullString", "pgtype.Text", "pgtype.UUID":
 		return "google.protobuf.StringValue"
-	case "sql.NullTime", "time.Time":
+	case "pgtype.Numeric", "decimal.Decimal", "decimal.NullDecimal", numericString, numericNullString:
+		return "google.type.Decimal"
+	case "sql.NullTime", "time.Time", "pgtype.Timestamptz", "pgtype.Timestamp", "pgtype.Date":
 		return "google.protobuf.Timestamp"
-	case "uuid.UUID", "net.HardwareAddr", "net.IP":
+	case "uuid.UUID", "net.HardwareAddr", "net.IP", "netip.Addr", "netip.Prefix":
 		return "string"
+	case "status.Status":
+		return "google.rpc.Status"
+	case "fieldmaskpb.FieldMask":
+		return "google.protobuf.FieldMask"
+	case "interface{}", "any":
+		return "google.protobuf.Value"
 	default:
-		if _, elementType := originalAndElementType(typ); elementType != "" {
+		if originalType, elementType := originalAndElementType(typ); elementType != "" {
+			switch elementType {
+			case enumElementType:
+				return originalType
+			case nullEnumElementType:
+				return strings.TrimPrefix(originalType, "Null")
+			}
 			return elementType
 		}
 		return typ
 	}
 }
 
-func bindToProto(src, dst, attrName, attrType string) []string {
+func bindToProto(src, dst, attrName, attrType string, overrides *typeOverrides) []string {
+	return valueToProto(fmt.Sprintf("%s.%s", src, attrName), fmt.Sprintf("%s.%s", dst, camelCaseProto(attrName)), attrType, overrides)
+}
+
+// valueToProto assigns the Go expression src to the proto field dst
+func valueToProto(src, dst, attrType string, overrides *typeOverrides) []string {
+	if o, ok := overrides.get(attrType); ok {
+		return overrideToProto(o, src, dst)
+	}
+	if isEnumType(attrType) {
+		return enumToProto(src, dst, attrType)
+	}
 	res := make([]string, 0)
 	switch attrType {
 	case "sql.NullBool":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = wrapperspb.Bool(%s.%s.Bool) }", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Bool(%s.Bool) }", dst, src))
 	case "sql.NullInt32":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = wrapperspb.Int32(%s.%s.Int32) }", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Int32(%s.Int32) }", dst, src))
 	case "sql.NullInt64":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = wrapperspb.Int64(%s.%s.Int64) }", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Int64(%s.Int64) }", dst, src))
 	case "sql.NullFloat64":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = wrapperspb.Double(%s.%s.Float64) }", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Double(%s.Float64) }", dst, src))
 	case "sql.NullString":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = wrapperspb.String(%s.%s.String) }", dst, camelCaseProto(attrName), src, attrName))
-	case "sql.NullTime":
-		res = append(res, fmt.Sprintf("if %s.%s.Valid {", src, attrName))
-		res = append(res, fmt.Sprintf("%s.%s = timestamppb.New(%s.%s.Time) }", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.String(%s.String) }", dst, src))
+	case "sql.NullTime", "pgtype.Timestamptz", "pgtype.Timestamp", "pgtype.Date":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = timestamppb.New(%s.Time) }", dst, src))
+	case "pgtype.Bool":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Bool(%s.Bool) }", dst, src))
+	case "pgtype.Int2":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Int32(int32(%s.Int16)) }", dst, src))
+	case "pgtype.Int4":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Int32(%s.Int32) }", dst, src))
+	case "pgtype.Int8":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Int64(%s.Int64) }", dst, src))
+	case "pgtype.Float4":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Float(%s.Float32) }", dst, src))
+	case "pgtype.Float8":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.Double(%s.Float64) }", dst, src))
+	case "pgtype.Text":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.String(%s.String) }", dst, src))
+	case "pgtype.UUID":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.String(uuid.UUID(%s.Bytes).String()) }", dst, src))
+	case "pgtype.Numeric":
+		// the text representation keeps the precision
+		res = append(res, fmt.Sprintf("if v, err := %s.Value(); err == nil && v != nil {", src))
+		res = append(res, fmt.Sprintf("%s = &decimalpb.Decimal{Value: fmt.Sprint(v)} }", dst))
+	case "decimal.Decimal":
+		res = append(res, fmt.Sprintf("%s = &decimalpb.Decimal{Value: %s.String()}", dst, src))
+	case numericString:
+		res = append(res, fmt.Sprintf("%s = &decimalpb.Decimal{Value: %s}", dst, src))
+	case numericNullString:
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = &decimalpb.Decimal{Value: %s.String} }", dst, src))
+	case "decimal.NullDecimal":
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = &decimalpb.Decimal{Value: %s.Decimal.String()} }", dst, src))
 	case "time.Time":
-		res = append(res, fmt.Sprintf("%s.%s = timestamppb.New(%s.%s)", dst, camelCaseProto(attrName), src, attrName))
-	case "uuid.UUID", "net.HardwareAddr", "net.IP":
-		res = append(res, fmt.Sprintf("%s.%s = %s.%s.String()", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("%s = timestamppb.New(%s)", dst, src))
+	case "uuid.UUID", "net.HardwareAddr", "net.IP", "netip.Addr", "netip.Prefix":
+		res = append(res, fmt.Sprintf("%s = %s.String()", dst, src))
+	case "*netip.Addr", "*netip.Prefix":
+		res = append(res, fmt.Sprintf("if %s != nil {", src))
+		res = append(res, fmt.Sprintf("%s = wrapperspb.String(%s.String()) }", dst, src))
 	case "int16":
-		res = append(res, fmt.Sprintf("%s.%s = int32(%s.%s)", dst, camelCaseProto(attrName), src, attrName))
+		res = append(res, fmt.Sprintf("%s = int32(%s)", dst, src))
+	case "interface{}", "any":
+		res = append(res, fmt.Sprintf("if v, err := structpb.NewValue(%s); err == nil {", src))
+		res = append(res, fmt.Sprintf("%s = v } else {", dst))
+		res = append(res, fmt.Sprintf("%s = structpb.NewStringValue(fmt.Sprint(%s)) }", dst, src))
 	default:
 		_, elementType := originalAndElementType(attrType)
 		if elementType != "" {
-			res = append(res, fmt.Sprintf("%s.%s = %s(%s.%s)", dst, camelCaseProto(attrName), elementType, src, attrName))
+			res = append(res, fmt.Sprintf("%s = %s(%s)", dst, elementType, src))
 		} else {
-			res = append(res, fmt.Sprintf("%s.%s = %s.%s", dst, camelCaseProto(attrName), src, attrName))
+			res = append(res, fmt.Sprintf("%s = %s", dst, src))
 		}
 	}
 	return res
 }
 
-func bindToGo(src, dst, attrName, attrType string, newVar bool) []string {
+func bindToGo(src, dst, attrName, attrType string, newVar bool, overrides *typeOverrides) []string {
+	if o, ok := overrides.get(attrType); ok {
+		return overrideToGo(o, src, dst, attrName, newVar)
+	}
+	if isEnumType(attrType) {
+		return enumToGo(fmt.Sprintf("%s.Get%s()", src, camelCaseProto(attrName)), dst, attrName, attrType, newVar)
+	}
 	res := make([]string, 0)
 	switch attrType {
 	case "sql.NullBool":
@@ -155,7 +267,105 @@ func bindToGo(src, dst, attrName, attrType string, newVar bool) []string {
 		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
 		res = append(res, fmt.Sprintf("%s = sql.NullString{Valid: true, String: v.Value}", dst))
 		res = append(res, "}")
-	case "sql.NullTime":
+	case "pgtype.Bool":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Bool{Valid: true, Bool: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.Int2":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Int2{Valid: true, Int16: int16(v.Value)}", dst))
+		res = append(res, "}")
+	case "pgtype.Int4":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Int4{Valid: true, Int32: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.Int8":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Int8{Valid: true, Int64: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.Float4":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Float4{Valid: true, Float32: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.Float8":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Float8{Valid: true, Float64: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.Text":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("%s = pgtype.Text{Valid: true, String: v.Value}", dst))
+		res = append(res, "}")
+	case "pgtype.UUID":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, "id, err := uuid.Parse(v.Value)")
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, "return nil, err }")
+		res = append(res, fmt.Sprintf("%s = pgtype.UUID{Valid: true, Bytes: id} }", dst))
+	case "pgtype.Numeric", "decimal.NullDecimal":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, "value, err := validation.Decimal(v.GetValue())")
+		if attrType == "pgtype.Numeric" {
+			res = append(res, fmt.Sprintf("if err == nil { err = %s.Scan(value) }", dst))
+		} else {
+			res = append(res, fmt.Sprintf("if err == nil { %s.Decimal, err = decimal.NewFromString(value)", dst))
+			res = append(res, fmt.Sprintf("%s.Valid = err == nil }", dst))
+		}
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, "return nil, err } }")
+	case numericString, numericNullString:
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, goType(attrType)))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, "value, err := validation.Decimal(v.GetValue())")
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, "return nil, err }")
+		if attrType == numericString {
+			res = append(res, fmt.Sprintf("%s = value", dst))
+			res = append(res, fmt.Sprintf("} else { err := fmt.Errorf(\"field %s is required%%w\", validation.ErrUserInput)", attrName))
+			res = append(res, "return nil, err }")
+		} else {
+			res = append(res, fmt.Sprintf("%s = sql.NullString{Valid: true, String: value} }", dst))
+		}
+	case "decimal.Decimal":
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, "value, err := validation.Decimal(v.GetValue())")
+		res = append(res, fmt.Sprintf("if err == nil { %s, err = decimal.NewFromString(value) }", dst))
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, "return nil, err }")
+		res = append(res, fmt.Sprintf("} else { err := fmt.Errorf(\"field %s is required%%w\", validation.ErrUserInput)", attrName))
+		res = append(res, "return nil, err }")
+	case "sql.NullTime", "pgtype.Timestamptz", "pgtype.Timestamp", "pgtype.Date":
 		if newVar {
 			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
 		}
@@ -190,6 +400,29 @@ func bindToGo(src, dst, attrName, attrType string, newVar bool) []string {
 		res = append(res, fmt.Sprintf("if v, err = net.ParseMAC(%s.Get%s()); err != nil {", src, camelCaseProto(attrName)))
 		res = append(res, fmt.Sprintf("err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
 		res = append(res, fmt.Sprintf("return nil, err } else { %s = v }", dst))
+	case "netip.Addr", "netip.Prefix":
+		parse := "netip.ParseAddr"
+		if attrType == "netip.Prefix" {
+			parse = "netip.ParsePrefix"
+		}
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v, err := %s(%s.Get%s()); err != nil {", parse, src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, fmt.Sprintf("return nil, err } else { %s = v }", dst))
+	case "*netip.Addr", "*netip.Prefix":
+		parse := "netip.ParseAddr"
+		if attrType == "*netip.Prefix" {
+			parse = "netip.ParsePrefix"
+		}
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, attrType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s.Get%s(); v != nil {", src, camelCaseProto(attrName)))
+		res = append(res, fmt.Sprintf("if addr, err := %s(v.Value); err != nil {", parse))
+		res = append(res, fmt.Sprintf("err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+		res = append(res, fmt.Sprintf("return nil, err } else { %s = &addr } }", dst))
 	case "net.IP":
 		if newVar {
 			res = append(res, fmt.Sprintf("%s := net.ParseIP(%s.Get%s())", dst, src, camelCaseProto(attrName)))
@@ -208,6 +441,12 @@ func bindToGo(src, dst, attrName, attrType string, newVar bool) []string {
 		} else {
 			res = append(res, fmt.Sprintf("%s = int(%s.Get%s())", dst, src, camelCaseProto(attrName)))
 		}
+	case "interface{}", "any":
+		if newVar {
+			res = append(res, fmt.Sprintf("%s := %s.Get%s().AsInterface()", dst, src, camelCaseProto(attrName)))
+		} else {
+			res = append(res, fmt.Sprintf("%s = %s.Get%s().AsInterface()", dst, src, camelCaseProto(attrName)))
+		}
 	case "uint16":
 		if newVar {
 			res = append(res, fmt.Sprintf("%s := uint16(%s.Get%s())", dst, src, camelCaseProto(attrName)))
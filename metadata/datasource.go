@@ -0,0 +1,207 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Datasource is a database connection of the generated server, shared by the packages with the same engine and driver
+// or with the same name on the -datasources option
+type Datasource struct {
+	Name       string
+	Engine     string
+	SqlPackage string
+	Packages   []*Package
+
+	// the only connection keeps the original -db flag
+	single bool
+}
+
+// Datasources groups the packages by datasource, in the order of the packages
+func (d *Definition) Datasources() []*Datasource {
+	res := make([]*Datasource, 0)
+	byKey := make(map[string]*Datasource)
+	for _, p := range d.Packages {
+		key := p.Datasource
+		if key == "" {
+			key = p.Engine + "/" + p.SqlPackage
+		}
+		ds, ok := byKey[key]
+		if !ok {
+			ds = &Datasource{
+				Name:       p.Datasource,
+				Engine:     p.Engine,
+				SqlPackage: p.SqlPackage,
+			}
+			byKey[key] = ds
+			res = append(res, ds)
+		}
+		ds.Packages = append(ds.Packages, p)
+	}
+
+	// the default names don't collide with the -datasources names or between them
+	taken := make(map[string]bool)
+	for _, ds := range res {
+		if ds.Name != "" {
+			ds.reserve(taken)
+		}
+	}
+	for _, ds := range res {
+		if ds.Name != "" {
+			continue
+		}
+		ds.Name = engineName(ds.Engine)
+		if ds.collides(taken) && ds.SqlPackage != "" {
+			ds.Name += "_pgx"
+		}
+		base := ds.Name
+		for i := 2; ds.collides(taken); i++ {
+			ds.Name = fmt.Sprintf("%s_%d", base, i)
+		}
+		ds.reserve(taken)
+	}
+	if len(res) == 1 {
+		res[0].single = true
+	}
+	return res
+}
+
+// SetDatasources assigns the packages to named datasources, like books=catalog
+func (d *Definition) SetDatasources(names map[string]string) error {
+	for pkg, name := range names {
+		var found bool
+		for _, p := range d.Packages {
+			if p.Package == pkg {
+				p.Datasource = name
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("datasource %q: unknown package %q", name, pkg)
+		}
+	}
+	var pgxVersion string
+	vars, flags := make(map[string]string), make(map[string]string)
+	for _, ds := range d.Datasources() {
+		if other, ok := vars[ds.Var()]; ok {
+			return fmt.Errorf("datasource %q: the name collides with %q, both use the variable %s", ds.Name, other, ds.Var())
+		}
+		if other, ok := flags[ds.Flag()]; ok {
+			return fmt.Errorf("datasource %q: the name collides with %q, both use the flag -%s", ds.Name, other, ds.Flag())
+		}
+		vars[ds.Var()], flags[ds.Flag()] = ds.Name, ds.Name
+		for _, p := range ds.Packages {
+			if p.Engine != ds.Engine || p.SqlPackage != ds.SqlPackage {
+				return fmt.Errorf("datasource %q: the packages %s and %s have different engines or sql_package", ds.Name, ds.Packages[0].Package, p.Package)
+			}
+		}
+		if ds.SqlPackage != "" {
+			if pgxVersion != "" && pgxVersion != ds.SqlPackage {
+				return fmt.Errorf("datasource %q: pgx/v4 and pgx/v5 can't be used together", ds.Name)
+			}
+			pgxVersion = ds.SqlPackage
+		}
+	}
+	return nil
+}
+
+// HasEngine checks if any package uses the engine (postgresql is the default)
+func (d *Definition) HasEngine(engine string) bool {
+	for _, p := range d.Packages {
+		if engineName(p.Engine) == engineName(engine) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDatabaseSQL checks if any datasource connects through database/sql
+func (d *Definition) HasDatabaseSQL() bool {
+	for _, p := range d.Packages {
+		if p.SqlPackage == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// DriverImports are the packages registering the database/sql drivers of the datasources
+func (d *Definition) DriverImports() []string {
+	res := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, ds := range d.Datasources() {
+		if ds.SqlPackage != "" {
+			continue
+		}
+		var path string
+		switch ds.Driver() {
+		case "mysql":
+			path = "github.com/go-sql-driver/mysql"
+		case "sqlite":
+			path = "modernc.org/sqlite"
+		default:
+			// the same pgconn errors of the pgx/v5 datasources
+			path = "github.com/jackc/pgx/v4/stdlib"
+			if d.SqlPackage() == "pgx/v5" {
+				path = "github.com/jackc/pgx/v5/stdlib"
+			}
+		}
+		if !seen[path] {
+			seen[path] = true
+			res = append(res, path)
+		}
+	}
+	return res
+}
+
+func engineName(engine string) string {
+	switch engine {
+	case "mysql", "sqlite":
+		return engine
+	}
+	return "postgres"
+}
+
+// Var is the name of the connection variable, like db or mysqlDB
+func (ds *Datasource) Var() string {
+	if ds.single {
+		return "db"
+	}
+	return lowerFirstCharacter(structName(ds.Name)) + "DB"
+}
+
+// Flag is the name of the connection URL flag, like db or mysql-db
+func (ds *Datasource) Flag() string {
+	if ds.single {
+		return "db"
+	}
+	return strings.ReplaceAll(ToSnakeCase(ds.Name), "_", "-") + "-db"
+}
+
+// Env is the environment variable with the default connection URL, like DB_URL or MYSQL_DB_URL
+func (ds *Datasource) Env() string {
+	if ds.single {
+		return "DB_URL"
+	}
+	return strings.ToUpper(strings.ReplaceAll(ToSnakeCase(ds.Name), "-", "_")) + "_DB_URL"
+}
+
+// collides checks if the variable, flag or environment variable of the datasource is taken
+func (ds *Datasource) collides(taken map[string]bool) bool {
+	return taken[ds.Var()] || taken[ds.Flag()] || taken[ds.Env()]
+}
+
+func (ds *Datasource) reserve(taken map[string]bool) {
+	taken[ds.Var()] = true
+	taken[ds.Flag()] = true
+	taken[ds.Env()] = true
+}
+
+// Driver is the database/sql driver name
+func (ds *Datasource) Driver() string {
+	switch ds.Engine {
+	case "mysql", "sqlite":
+		return ds.Engine
+	}
+	return "pgx"
+}
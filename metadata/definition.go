@@ -8,6 +8,7 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/emicklei/proto"
@@ -28,16 +29,39 @@ func (d *Definition) Database() string {
 	return ""
 }
 
+// SqlPackage is the driver package of the generated code: pgx/v4, pgx/v5 or empty for database/sql
+func (d *Definition) SqlPackage() string {
+	for _, p := range d.Packages {
+		if p.SqlPackage != "" {
+			return p.SqlPackage
+		}
+	}
+	return ""
+}
+
 type PackageOpts struct {
-	Path               string
-	EmitInterface      bool
-	EmitParamsPointers bool
-	EmitResultPointers bool
-	EmitDbArgument     bool
+	Path                string
+	Engine              string
+	SqlPackage          string
+	Package             string
+	EmitInterface       bool
+	EmitParamsPointers  bool
+	EmitResultPointers  bool
+	EmitDbArgument      bool
+	EmitExactTableNames bool
+	ServerStreaming     []*regexp.Regexp
+	CopyFromBatchSize   int
+	ZeroRowsNotFound    bool
+	MaxPageSize         int
+	FieldMask           bool
+	Resource            bool
+	TypeOverrides       []*TypeOverride
 }
 
 type Package struct {
 	Engine                     string
+	SqlPackage                 string
+	Datasource                 string
 	Package                    string
 	GoModule                   string
 	SchemaPath                 string
@@ -45,14 +69,24 @@ type Package struct {
 	Services                   []*Service
 	Messages                   map[string]*Message
 	OutputAdapters             []*Message
+	Enums                      []*Message
 	EmitInterface              bool
 	EmitParamsPointers         bool
 	EmitResultPointers         bool
 	EmitDbArgument             bool
+	CopyFromBatchSize          int
+	MaxPageSize                int
 	CustomProtoOptions         []string
 	CustomProtoImports         []string
 	CustomServiceProtoComments []string
 	CustomServiceProtoOptions  []string
+
+	serverStreaming  []*regexp.Regexp
+	zeroRowsNotFound bool
+	fieldMask        bool
+	resourceMode     bool
+	exactTableNames  bool
+	overrides        *typeOverrides
 }
 
 func (p *Package) ProtoImports() []string {
@@ -64,7 +98,27 @@ func (p *Package) ProtoImports() []string {
 	if p.importWrappers() {
 		r = append(r, `import "google/protobuf/wrappers.proto";`)
 	}
+	if p.importStruct() {
+		r = append(r, `import "google/protobuf/struct.proto";`)
+	}
+	if p.importDecimal() {
+		r = append(r, `import "google/type/decimal.proto";`)
+	}
+	if p.HasBatch() {
+		r = append(r, `import "google/rpc/status.proto";`)
+	}
+	if p.HasFieldMask() {
+		r = append(r, `import "google/protobuf/field_mask.proto";`)
+	}
+	if p.HasInternal() {
+		r = append(r, `import "google/api/visibility.proto";`)
+	}
 	r = append(r, `import "protoc-gen-openapiv2/options/annotations.proto";`)
+	for _, o := range p.usedOverrides() {
+		if i := fmt.Sprintf("import \"%s\";", o.ProtoImport); o.ProtoImport != "" && !contains(r, i) {
+			r = append(r, i)
+		}
+	}
 	imports := strings.Join(r, " ")
 	for _, i := range p.CustomProtoImports {
 		if !strings.Contains(imports, i) {
@@ -125,20 +179,34 @@ func (p *Package) LoadOptions(protoFile string) {
 
 	proto.Walk(def, proto.WithRPC(func(rpc *proto.RPC) {
 		res := make([]string, 0)
+		httpOptions := make([]string, 0)
 
 		for _, e := range rpc.Elements {
 			opt, ok := e.(*proto.Option)
 			if !ok {
 				continue
 			}
-			res = append(res, fmt.Sprintf("option %s = {", opt.Name))
-			res = append(res, printProtoLiteral(opt.Constant.OrderedMap, 1)...)
-			res = append(res, "};")
+			lines := make([]string, 0)
+			if opt.Constant.Source != "" {
+				lines = append(lines, fmt.Sprintf("option %s = %s;", opt.Name, opt.Constant.SourceRepresentation()))
+			} else {
+				lines = append(lines, fmt.Sprintf("option %s = {", opt.Name))
+				lines = append(lines, printProtoLiteral(opt.Constant.OrderedMap, 1)...)
+				lines = append(lines, "};")
+			}
+			// kept unless the directives or the shape of the RPC change the route
+			if opt.Name == "(google.api.http)" || strings.HasPrefix(opt.Name, "(google.api.method_visibility)") {
+				httpOptions = append(httpOptions, lines...)
+				continue
+			}
+			res = append(res, lines...)
 		}
 
 		for _, s := range p.Services {
 			if s.Name == rpc.Name {
 				s.CustomProtoOptions = res
+				s.protoHttpOptions = httpOptions
+				s.protoRPC = rpc
 				if rpc.Comment != nil {
 					s.CustomProtoComments = clearLines(rpc.Comment.Lines)
 				}
@@ -150,58 +218,123 @@ func (p *Package) LoadOptions(protoFile string) {
 	proto.Walk(def, proto.WithMessage(func(protoMessage *proto.Message) {
 		msg, ok := p.Messages[protoMessage.Name]
 		if !ok {
-			if strings.HasSuffix(protoMessage.Name, "Request") {
-				msg, ok = p.Messages[protoMessage.Name[0:len(protoMessage.Name)-7]+"Params"]
-				if !ok {
-					return
+			if !strings.HasSuffix(protoMessage.Name, "Request") {
+				return
+			}
+			for _, m := range p.Messages {
+				if m.ProtoName() == protoMessage.Name {
+					msg, ok = m, true
+					break
 				}
-			} else {
+			}
+			if !ok {
 				return
 			}
 		}
 		msg.loadOptions(protoMessage)
 	}))
+
+	proto.Walk(def, proto.WithEnum(func(protoEnum *proto.Enum) {
+		if msg, ok := p.Messages[protoEnum.Name]; ok && msg.IsEnum {
+			msg.loadEnumOptions(protoEnum)
+		}
+	}))
 }
 
-func (p *Package) importTimestamp() bool {
-	for _, m := range p.Messages {
-		for _, f := range m.Fields {
-			if f.Type == "time.Time" || f.Type == "sql.NullTime" {
-				return true
-			}
+func (p *Package) HasServerStreaming() bool {
+	for _, s := range p.Services {
+		if s.ServerStreaming {
+			return true
 		}
 	}
+	return false
+}
+
+func (p *Package) HasClientStreaming() bool {
 	for _, s := range p.Services {
-		for _, n := range s.InputTypes {
-			if n == "time.Time" || n == "sql.NullTime" {
-				return true
-			}
+		if s.ClientStreaming {
+			return true
 		}
+	}
+	return false
+}
 
-		if s.Output == "time.Time" || s.Output == "sql.NullTime" {
+func (p *Package) HasInternal() bool {
+	for _, s := range p.Services {
+		if s.Internal() {
 			return true
 		}
+	}
+	return false
+}
 
+func (p *Package) HasBatch() bool {
+	for _, s := range p.Services {
+		if s.Batch {
+			return true
+		}
 	}
 	return false
 }
 
+func (p *Package) importTimestamp() bool {
+	return p.hasProtoType(func(typ string) bool {
+		return typ == "google.protobuf.Timestamp"
+	})
+}
+
 func (p *Package) importWrappers() bool {
+	return p.hasProtoType(func(typ string) bool {
+		return strings.HasPrefix(typ, "google.protobuf.") && strings.HasSuffix(typ, "Value")
+	})
+}
+
+func (p *Package) importStruct() bool {
+	return p.hasProtoType(func(typ string) bool {
+		return typ == "google.protobuf.Value"
+	})
+}
+
+// HasDecimal checks if any package uses google.type.Decimal
+func (d *Definition) HasDecimal() bool {
+	for _, p := range d.Packages {
+		if p.importDecimal() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Package) importDecimal() bool {
+	return p.hasProtoType(func(typ string) bool {
+		return typ == "google.type.Decimal"
+	})
+}
+
+// hasProtoType checks the proto types (or the element types of the repeated ones) of the messages fields, params and results
+func (p *Package) hasProtoType(match func(string) bool) bool {
+	return p.hasGoType(func(typ string) bool {
+		return match(strings.TrimPrefix(toProtoType(typ, p.overrides), "repeated "))
+	})
+}
+
+// hasGoType checks the Go types of the messages fields, params and results
+func (p *Package) hasGoType(match func(string) bool) bool {
 	for _, m := range p.Messages {
 		for _, f := range m.Fields {
-			if strings.HasPrefix(f.Type, "sql.Null") && f.Type != "sql.NullTime" {
+			if match(f.Type) {
 				return true
 			}
 		}
 	}
 	for _, s := range p.Services {
 		for _, n := range s.InputTypes {
-			if strings.HasPrefix(n, "sql.Null") && n != "sql.NullTime" {
+			if match(n) {
 				return true
 			}
 		}
 
-		if strings.HasPrefix(s.Output, "sql.Null") && s.Output != "sql.NullTime" {
+		if match(s.Output) {
 			return true
 		}
 
@@ -218,9 +351,15 @@ func ParsePackage(opts PackageOpts, queriesToIgnore []*regexp.Regexp) (*Package,
 	if total := len(pkgs); total != 1 {
 		return nil, fmt.Errorf("too many packages: %d", total)
 	}
+	overrides, err := newTypeOverrides(opts.TypeOverrides)
+	if err != nil {
+		return nil, err
+	}
 
 	for pkgName, pkg := range pkgs {
 		p := Package{
+			Engine:             opts.Engine,
+			SqlPackage:         sqlPackage(opts.SqlPackage),
 			Package:            pkgName,
 			SrcPath:            opts.Path,
 			Messages:           make(map[string]*Message),
@@ -228,13 +367,27 @@ func ParsePackage(opts PackageOpts, queriesToIgnore []*regexp.Regexp) (*Package,
 			EmitParamsPointers: opts.EmitParamsPointers,
 			EmitResultPointers: opts.EmitResultPointers,
 			EmitDbArgument:     opts.EmitDbArgument,
+			CopyFromBatchSize:  copyFromBatchSize(opts),
+			MaxPageSize:        maxPageSize(opts),
+			serverStreaming:    opts.ServerStreaming,
+			zeroRowsNotFound:   opts.ZeroRowsNotFound,
+			fieldMask:          opts.FieldMask,
+			resourceMode:       opts.Resource,
+			exactTableNames:    opts.EmitExactTableNames,
+			overrides:          overrides,
+		}
+
+		if p.SqlPackage == "" {
+			p.SqlPackage = detectSqlPackage(pkg.Files)
 		}
 
 		constants := make(map[string]string)
+		batchResults := make(map[string]string)
 		for _, file := range pkg.Files {
+			addBatchResults(batchResults, file)
 			if file.Scope != nil {
 				for name, obj := range file.Scope.Objects {
-					if name == "Queries" || name == "Service" {
+					if name == "Queries" || name == "Service" || strings.HasSuffix(name, "BatchResults") {
 						continue
 					}
 					addConstant(constants, name, obj)
@@ -263,6 +416,13 @@ func ParsePackage(opts PackageOpts, queriesToIgnore []*regexp.Regexp) (*Package,
 
 				}
 			}
+		}
+		for _, file := range pkg.Files {
+			addEnumValues(&p, file)
+		}
+		p.markNullEnums()
+
+		for _, file := range pkg.Files {
 			for _, n := range file.Decls {
 				if fun, ok := n.(*ast.FuncDecl); ok {
 					var ignore bool
@@ -272,43 +432,191 @@ func ParsePackage(opts PackageOpts, queriesToIgnore []*regexp.Regexp) (*Package,
 							break
 						}
 					}
-					if !ignore {
-						visitFunc(fun, &p, constants)
+					if ignore {
+						continue
+					}
+					if err := visitFunc(fset, fun, &p, constants, batchResults); err != nil {
+						return nil, err
 					}
 				}
 			}
 		}
 
-		for _, m := range p.Messages {
-			m.adjustType(p.Messages)
+		p.resolve()
+		if err := p.checkTypes(); err != nil {
+			return nil, err
 		}
+		return &p, nil
+	}
+	return nil, nil
+}
 
-		sort.SliceStable(p.Services, func(i, j int) bool {
-			return strings.Compare(p.Services[i].Name, p.Services[j].Name) < 0
-		})
+// sqlPackage normalizes the sql_package option of sqlc, database/sql is the default
+func sqlPackage(name string) string {
+	if name == "pgx/v4" || name == "pgx/v5" {
+		return name
+	}
+	return ""
+}
 
-		outAdapters := make(map[string]struct{})
+// detectSqlPackage finds the pgx version imported by the code generated by sqlc without a sql_package on the config
+func detectSqlPackage(files map[string]*ast.File) string {
+	var res string
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(path, "github.com/jackc/pgx/v5"):
+				return "pgx/v5"
+			case strings.HasPrefix(path, "github.com/jackc/pgx/v4"), path == "github.com/jackc/pgconn":
+				res = "pgx/v4"
+			}
+		}
+	}
+	return res
+}
 
-		for _, s := range p.Services {
-			if s.HasCustomOutput() || s.HasArrayOutput() {
-				outAdapters[canonicalName(s.Output)] = struct{}{}
+const defaultCopyFromBatchSize = 1000
+
+func copyFromBatchSize(opts PackageOpts) int {
+	if opts.CopyFromBatchSize > 0 {
+		return opts.CopyFromBatchSize
+	}
+	return defaultCopyFromBatchSize
+}
+
+// resolve adjusts the alias types and collects the output adapters after all services were added.
+func (p *Package) resolve() {
+	for _, m := range p.Messages {
+		m.adjustType(p.Messages)
+		m.overrides = p.overrides
+	}
+	if p.fieldMask {
+		p.partialUpdates()
+	}
+	if p.resourceMode {
+		p.groupResources()
+	}
+	p.markSharedNestedPaths()
+
+	sort.SliceStable(p.Services, func(i, j int) bool {
+		return strings.Compare(p.Services[i].Name, p.Services[j].Name) < 0
+	})
+
+	outAdapters := make(map[string]struct{})
+
+	for _, s := range p.Services {
+		if s.HasCustomOutput() || s.HasArrayOutput() {
+			if m, ok := p.Messages[canonicalName(s.Output)]; !ok || m.IsEnum || m.IsNullEnum {
+				continue
 			}
+			outAdapters[canonicalName(s.Output)] = struct{}{}
+		}
+	}
+
+	p.OutputAdapters = make([]*Message, len(outAdapters))
+	i := 0
+	for k := range outAdapters {
+		p.OutputAdapters[i] = p.Messages[k]
+		i++
+	}
+
+	sort.SliceStable(p.OutputAdapters, func(i, j int) bool {
+		return strings.Compare(p.OutputAdapters[i].Name, p.OutputAdapters[j].Name) < 0
+	})
+
+	p.Enums = make([]*Message, 0)
+	for _, m := range p.Messages {
+		if m.IsEnum {
+			p.Enums = append(p.Enums, m)
 		}
+	}
+	sort.SliceStable(p.Enums, func(i, j int) bool {
+		return strings.Compare(p.Enums[i].Name, p.Enums[j].Name) < 0
+	})
+}
 
-		p.OutputAdapters = make([]*Message, len(outAdapters))
-		i := 0
-		for k := range outAdapters {
-			p.OutputAdapters[i] = p.Messages[k]
-			i++
+// checkTypes fails on the Go types without a conversion to proto, like the pgtype.Interval of pgx
+func (p *Package) checkTypes() error {
+	for _, s := range p.Services {
+		for i, typ := range s.InputTypes {
+			if !p.convertible(adjustType(typ, p.Messages)) {
+				return unsupportedType(s.Query+" param "+s.InputNames[i], typ)
+			}
 		}
+		if !s.EmptyOutput() && !s.isExecResult() && !p.convertible(adjustType(s.Output, p.Messages)) {
+			return unsupportedType(s.Query+" result", s.Output)
+		}
+	}
+	names := make([]string, 0, len(p.Messages))
+	for name := range p.Messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := p.Messages[name]
+		if m.IsEnum || m.IsNullEnum {
+			continue
+		}
+		for _, f := range m.Fields {
+			if !p.convertible(f.Type) {
+				return unsupportedType(m.Name+"."+f.Name, f.Type)
+			}
+		}
+	}
+	return nil
+}
 
-		sort.SliceStable(p.OutputAdapters, func(i, j int) bool {
-			return strings.Compare(p.OutputAdapters[i].Name, p.OutputAdapters[j].Name) < 0
-		})
+func (p *Package) convertible(typ string) bool {
+	protoType := strings.TrimPrefix(toProtoType(typ, p.overrides), "repeated ")
+	switch protoType {
+	case "double", "float", "int32", "int64", "uint32", "uint64", "bool", "string", "bytes":
+		return true
+	}
+	if _, ok := p.Messages[protoType]; ok {
+		return true
+	}
+	return strings.HasPrefix(protoType, "google.")
+}
 
-		return &p, nil
+func unsupportedType(name, typ string) error {
+	return fmt.Errorf("%s: the type %s has no proto conversion, map it with the -types option (the types option on plugin mode)", name, typ)
+}
+
+// addEnumValues adds the typed string constants, like BookTypeFICTION BookType = "FICTION", to the enum of its type
+func addEnumValues(p *Package, file *ast.File) {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok || len(vs.Names) != 1 || len(vs.Values) != 1 {
+				continue
+			}
+			typ, ok := vs.Type.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			lit, ok := vs.Values[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+			msg, ok := p.Messages[typ.Name]
+			if !ok || msg.ElementType != "string" {
+				continue
+			}
+			value, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				continue
+			}
+			msg.addEnumValue(vs.Names[0].Name, value)
+		}
 	}
-	return nil, nil
 }
 
 func addConstant(constants map[string]string, name string, obj *ast.Object) {
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// directivePrefix starts the comments of a query that customize its RPC, like "-- grpc: paginate=keyset"
+const directivePrefix = "grpc:"
+
+// directives are the valid keys of the directives and their valid values (nil for any value)
+var directives = map[string][]string{
+	"paginate":   {"keyset"},
+	"method":     {"get", "post", "put", "patch", "delete"},
+	"path":       nil,
+	"body":       nil,
+	"stream":     {"server", "none"},
+	"name":       nil,
+	"auth":       nil,
+	"deprecated": {""},
+	"visibility": {"internal"},
+	"skip":       {""},
+}
+
+// parseDirectives reads the key=value pairs of the directives from the query comments (or the doc comments sqlc writes from them)
+func parseDirectives(comments []string) map[string]string {
+	res := make(map[string]string)
+	for _, c := range comments {
+		c = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(c), "-/"))
+		if !strings.HasPrefix(c, directivePrefix) {
+			continue
+		}
+		for _, d := range strings.Fields(strings.TrimPrefix(c, directivePrefix)) {
+			k, v, _ := strings.Cut(d, "=")
+			if k == "method" {
+				v = strings.ToLower(v)
+			}
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// sqlComments returns the comments of the query text, except the sqlc header
+func sqlComments(sql string) []string {
+	res := make([]string, 0)
+	for _, line := range strings.Split(strings.ReplaceAll(sql, "`", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "-- name:") {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// validateDirectives fails on the unknown directives and the invalid values
+func (s *Service) validateDirectives() error {
+	keys := make([]string, 0, len(s.directives))
+	for k := range s.directives {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := s.directives[k]
+		values, ok := directives[k]
+		if !ok {
+			return fmt.Errorf("%s: unknown directive %q", s.Query, k)
+		}
+		if values == nil {
+			if v == "" {
+				return fmt.Errorf("%s: the directive %q requires a value", s.Query, k)
+			}
+			continue
+		}
+		if !contains(values, v) {
+			if len(values) == 1 && values[0] == "" {
+				return fmt.Errorf("%s: the directive %q takes no value", s.Query, k)
+			}
+			return fmt.Errorf("%s: invalid value %q of the directive %q (valid: %s)", s.Query, v, k, strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
+
+func (s *Service) hasDirective(key string) bool {
+	_, ok := s.directives[key]
+	return ok
+}
+
+// AuthRole is the role required to call the method, from the "auth" directive
+func (s *Service) AuthRole() string {
+	return s.directives["auth"]
+}
+
+// HasAuth checks if any method requires a role
+func (d *Definition) HasAuth() bool {
+	for _, p := range d.Packages {
+		for _, s := range p.Services {
+			if s.AuthRole() != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Internal methods are served only by the gRPC server, from the "visibility=internal" directive
+func (s *Service) Internal() bool {
+	return s.directives["visibility"] == "internal"
+}
+
+func (s *Service) Deprecated() bool {
+	return s.hasDirective("deprecated")
+}
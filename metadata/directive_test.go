@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []string
+		want     map[string]string
+	}{
+		{name: "none", comments: []string{"-- ListBooks returns the books"}, want: map[string]string{}},
+		{name: "sql comment", comments: []string{"-- grpc: paginate=keyset"}, want: map[string]string{"paginate": "keyset"}},
+		{name: "doc comment", comments: []string{"// ListBooks returns the books", "//grpc: skip"}, want: map[string]string{"skip": ""}},
+		{
+			name:     "many on a line",
+			comments: []string{"-- grpc: method=POST path=/v1/books:search body=*"},
+			want:     map[string]string{"method": "post", "path": "/v1/books:search", "body": "*"},
+		},
+		{
+			name:     "many lines",
+			comments: []string{"-- grpc: name=SearchBooks", "-- grpc: auth=admin deprecated"},
+			want:     map[string]string{"name": "SearchBooks", "auth": "admin", "deprecated": ""},
+		},
+		{name: "not a directive", comments: []string{"-- see grpc: docs"}, want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDirectives(tt.comments); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDirectives(%q) = %v, want %v", tt.comments, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSqlComments(t *testing.T) {
+	sql := "`-- name: ListBooks :many\n-- grpc: stream=server\nSELECT * FROM books -- trailing\n  -- grpc: name=Books\n`"
+	want := []string{"-- grpc: stream=server", "-- grpc: name=Books"}
+	if got := sqlComments(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("sqlComments() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateDirectives(t *testing.T) {
+	tests := []struct {
+		directives map[string]string
+		wantErr    string
+	}{
+		{directives: map[string]string{}},
+		{directives: map[string]string{"paginate": "keyset", "method": "post", "path": "/books", "body": "*", "auth": "admin", "deprecated": ""}},
+		{directives: map[string]string{"visibility": "internal", "stream": "none", "name": "Books", "skip": ""}},
+		{directives: map[string]string{"pagination": "keyset"}, wantErr: `unknown directive "pagination"`},
+		{directives: map[string]string{"paginate": "offset"}, wantErr: `invalid value "offset" of the directive "paginate"`},
+		{directives: map[string]string{"method": "fetch"}, wantErr: `invalid value "fetch" of the directive "method"`},
+		{directives: map[string]string{"visibility": "private"}, wantErr: `invalid value "private" of the directive "visibility"`},
+		{directives: map[string]string{"stream": "client"}, wantErr: `invalid value "client" of the directive "stream"`},
+		{directives: map[string]string{"path": ""}, wantErr: `the directive "path" requires a value`},
+		{directives: map[string]string{"skip": "true"}, wantErr: `the directive "skip" takes no value`},
+	}
+	for _, tt := range tests {
+		s := &Service{Query: "ListBooks", directives: tt.directives}
+		err := s.validateDirectives()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateDirectives(%v) unexpected error: %v", tt.directives, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateDirectives(%v) error = %v, want %q", tt.directives, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInvalidDirectiveFailsPackage(t *testing.T) {
+	id := &plugin.Column{Name: "id", NotNull: true, Type: &plugin.Identifier{Name: "bigint"}, Table: &plugin.Identifier{Name: "books"}}
+	title := &plugin.Column{Name: "title", NotNull: true, Type: &plugin.Identifier{Name: "text"}, Table: &plugin.Identifier{Name: "books"}}
+	tests := []struct {
+		name    string
+		query   *plugin.Query
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			query: &plugin.Query{Name: "GetBook", Cmd: ":one", Comments: []string{"grpc: method=post"}, Columns: []*plugin.Column{id, title}, Params: []*plugin.Parameter{{Number: 1, Column: id}}},
+		},
+		{
+			name:    "invalid method",
+			query:   &plugin.Query{Name: "GetBook", Cmd: ":one", Comments: []string{"grpc: method=fetch"}, Columns: []*plugin.Column{id, title}, Params: []*plugin.Parameter{{Number: 1, Column: id}}},
+			wantErr: `GetBook: invalid value "fetch" of the directive "method"`,
+		},
+		{
+			name:    "unknown directive of a skipped query",
+			query:   &plugin.Query{Name: "GetBook", Cmd: ":one", Comments: []string{"grpc: skip internal"}, Columns: []*plugin.Column{id, title}, Params: []*plugin.Parameter{{Number: 1, Column: id}}},
+			wantErr: `GetBook: unknown directive "internal"`,
+		},
+		{
+			name:    "server streaming of a :one query",
+			query:   &plugin.Query{Name: "GetBook", Cmd: ":one", Comments: []string{"grpc: stream=server"}, Columns: []*plugin.Column{id, title}, Params: []*plugin.Parameter{{Number: 1, Column: id}}},
+			wantErr: "only the :many queries can be server-streaming",
+		},
+		{
+			name:    "keyset without LIMIT",
+			query:   &plugin.Query{Name: "ListBooks", Cmd: ":many", Comments: []string{"grpc: paginate=keyset"}, Columns: []*plugin.Column{id, title}, Params: []*plugin.Parameter{{Number: 1, Column: title}}},
+			wantErr: "ListBooks: keyset pagination",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Text = "SELECT id, title FROM books WHERE id = $1"
+			req := &plugin.GenerateRequest{
+				Settings: &plugin.Settings{Engine: "postgresql"},
+				Queries:  []*plugin.Query{tt.query},
+			}
+			_, err := ParseGenerateRequest(req, PackageOpts{Path: "internal/books"}, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
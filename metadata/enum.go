@@ -0,0 +1,180 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/emicklei/proto"
+)
+
+// element types of the sqlc enums and of the structs sqlc emits for nullable enums
+const (
+	enumElementType     = "enum"
+	nullEnumElementType = "nullenum"
+)
+
+type EnumValue struct {
+	Name      string
+	Value     string
+	ProtoName string
+	Number    int
+}
+
+func (m *Message) addEnumValue(name, value string) {
+	m.IsEnum = true
+	m.EnumValues = append(m.EnumValues, &EnumValue{
+		Name:      name,
+		Value:     value,
+		ProtoName: enumValueProtoName(m.Name, value),
+	})
+}
+
+func (m *Message) UnspecifiedProtoName() string {
+	return enumValueProtoName(m.Name, "unspecified")
+}
+
+func (m *Message) ProtoEnumValues() string {
+	var s strings.Builder
+	s.WriteString(m.protoReserved())
+	s.WriteString(fmt.Sprintf("    %s = 0;\n", m.UnspecifiedProtoName()))
+	tag := m.maxFieldNumber()
+	for _, v := range m.EnumValues {
+		if v.Number == 0 {
+			tag = m.nextFieldNumber(tag)
+			v.Number = tag
+		}
+		s.WriteString(fmt.Sprintf("    %s = %d;\n", v.ProtoName, v.Number))
+	}
+	return s.String()
+}
+
+func (m *Message) loadEnumOptions(protoEnum *proto.Enum) {
+	if protoEnum.Comment != nil {
+		m.CustomProtoComments = clearLines(protoEnum.Comment.Lines)
+	}
+	for _, e := range protoEnum.Elements {
+		if r, ok := e.(*proto.Reserved); ok {
+			m.ReservedRanges = append(m.ReservedRanges, r.Ranges...)
+			m.ReservedNames = append(m.ReservedNames, r.FieldNames...)
+		}
+
+		f, ok := e.(*proto.EnumField)
+		if !ok || f.Integer == 0 {
+			continue
+		}
+		var exists bool
+		for _, v := range m.EnumValues {
+			if v.ProtoName == f.Name {
+				exists = true
+				v.Number = f.Integer
+				break
+			}
+		}
+		if !exists {
+			m.reserve(f.Integer, f.Name)
+		}
+	}
+
+	// a value added back to the enum gets a fresh number, but the name can't stay reserved
+	names := make([]string, 0, len(m.ReservedNames))
+	for _, n := range m.ReservedNames {
+		var inUse bool
+		for _, v := range m.EnumValues {
+			if v.ProtoName == n {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			names = append(names, n)
+		}
+	}
+	m.ReservedNames = names
+}
+
+// markNullEnums flags the structs sqlc emits for nullable enums, like NullBookType{BookType BookType; Valid bool}
+func (p *Package) markNullEnums() {
+	for name, m := range p.Messages {
+		if !strings.HasPrefix(name, "Null") || len(m.Fields) != 2 {
+			continue
+		}
+		enum, ok := p.Messages[strings.TrimPrefix(name, "Null")]
+		if !ok || !enum.IsEnum {
+			continue
+		}
+		for _, f := range m.Fields {
+			if f.Name == enum.Name && f.Type == enum.Name {
+				m.IsNullEnum = true
+			}
+		}
+	}
+}
+
+func enumValueProtoName(enum, value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, ToSnakeCase(value))
+	return strings.ToUpper(ToSnakeCase(enum) + "_" + value)
+}
+
+// enumToProto converts the Go expression src of an enum type to the protobuf dst
+func enumToProto(src, dst, typ string) []string {
+	res := make([]string, 0)
+	originalType, elementType := originalAndElementType(typ)
+	switch {
+	case elementType == nullEnumElementType:
+		enum := strings.TrimPrefix(originalType, "Null")
+		res = append(res, fmt.Sprintf("if %s.Valid {", src))
+		res = append(res, fmt.Sprintf("%s = to%s(%s.%s) }", dst, enum, src, enum))
+	case strings.HasPrefix(typ, "[]"):
+		res = append(res, fmt.Sprintf("for _, v := range %s {", src))
+		res = append(res, fmt.Sprintf("%s = append(%s, to%s(v)) }", dst, dst, originalType))
+	default:
+		res = append(res, fmt.Sprintf("%s = to%s(%s)", dst, originalType, src))
+	}
+	return res
+}
+
+// enumToGo converts the protobuf expression src to the Go dst of an enum type, rejecting unknown values
+func enumToGo(src, dst, attrName, typ string, newVar bool) []string {
+	res := make([]string, 0)
+	originalType, elementType := originalAndElementType(typ)
+	switch {
+	case elementType == nullEnumElementType:
+		enum := strings.TrimPrefix(originalType, "Null")
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, originalType))
+		}
+		res = append(res, fmt.Sprintf("if v := %s; v != pb.%s_%s {", src, enum, enumValueProtoName(enum, "unspecified")))
+		res = append(res, fmt.Sprintf("e, err := from%s(v)", enum))
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%w\", err)", attrName))
+		res = append(res, "return nil, err }")
+		res = append(res, fmt.Sprintf("%s = %s{Valid: true, %s: e} }", dst, originalType, enum))
+	case strings.HasPrefix(typ, "[]"):
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s []%s", dst, originalType))
+		}
+		res = append(res, fmt.Sprintf("for _, v := range %s {", src))
+		res = append(res, fmt.Sprintf("e, err := from%s(v)", originalType))
+		res = append(res, fmt.Sprintf("if err != nil { err = fmt.Errorf(\"invalid %s: %%w\", err)", attrName))
+		res = append(res, "return nil, err }")
+		res = append(res, fmt.Sprintf("%s = append(%s, e) }", dst, dst))
+	default:
+		if newVar {
+			res = append(res, fmt.Sprintf("var %s %s", dst, originalType))
+		}
+		res = append(res, fmt.Sprintf("if v, err := from%s(%s); err != nil {", originalType, src))
+		res = append(res, fmt.Sprintf("err = fmt.Errorf(\"invalid %s: %%w\", err)", attrName))
+		res = append(res, fmt.Sprintf("return nil, err } else { %s = v }", dst))
+	}
+	return res
+}
+
+func isEnumType(typ string) bool {
+	_, elementType := originalAndElementType(typ)
+	return elementType == enumElementType || elementType == nullEnumElementType
+}
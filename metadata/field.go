@@ -8,16 +8,17 @@ import (
 type Field struct {
 	Name                string
 	Type                string
+	Number              int
 	CustomProtoComments []string
 	CustomProtoOptions  []string
 }
 
-func (f *Field) Proto(tag int) string {
+func (f *Field) proto(tag int, overrides *typeOverrides) string {
 	var sb strings.Builder
 	for _, line := range f.CustomProtoComments {
 		sb.WriteString(fmt.Sprintf("    // %s\n", line))
 	}
-	sb.WriteString(fmt.Sprintf("    %s %s = %d%s;\n", toProtoType(f.Type), ToSnakeCase(f.Name), tag, f.formatProtoOptions()))
+	sb.WriteString(fmt.Sprintf("    %s %s = %d%s;\n", toProtoType(f.Type, overrides), ToSnakeCase(f.Name), tag, f.formatProtoOptions()))
 	return sb.String()
 }
 
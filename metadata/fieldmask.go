@@ -0,0 +1,168 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// updateMaskField is the field of the partial update requests with the fields to change (https://google.aip.dev/134)
+const updateMaskField = "update_mask"
+
+// partialUpdates turns the UPDATE queries of an entity with a Get query, like UpdateBook and GetBook, into PATCH methods with an update_mask
+func (p *Package) partialUpdates() {
+	services := make(map[string]*Service)
+	for _, s := range p.Services {
+		services[s.Name] = s
+	}
+	for _, s := range p.Services {
+		if sqlCommand(s.Sql) != "UPDATE" || !s.HasCustomParams() || s.Batch || s.ClientStreaming {
+			continue
+		}
+		verb := prefix(s.Name)
+		if v := strings.ToLower(verb); v != "update" && v != "modify" {
+			continue
+		}
+		getter, ok := services["Get"+s.Name[len(verb):]]
+		if !ok || getter.HasArrayParams() || getter.EmptyInput() || !getter.HasCustomOutput() || queryCommand(getter.Sql) != ":one" {
+			continue
+		}
+		m, ok := p.Messages[canonicalName(s.InputTypes[0])]
+		if !ok {
+			continue
+		}
+		keys := s.getterParams(m, getter)
+		if keys == nil {
+			continue
+		}
+		s.FieldMask = true
+		s.getter = getter
+		s.getterKeys = keys
+		m.Fields = append(m.Fields, &Field{Name: updateMaskField, Type: "fieldmaskpb.FieldMask"})
+	}
+}
+
+// getterParams returns the fields of the update params with the same name and type of the Get query params
+func (s *Service) getterParams(m *Message, getter *Service) []*Field {
+	names, types := getter.InputNames, getter.InputTypes
+	if getter.HasCustomParams() {
+		gm, ok := s.Messages[canonicalName(getter.InputTypes[0])]
+		if !ok {
+			return nil
+		}
+		names, types = make([]string, 0), make([]string, 0)
+		for _, f := range gm.Fields {
+			names = append(names, f.Name)
+			types = append(types, f.Type)
+		}
+	}
+	keys := make([]*Field, 0, len(names))
+	for i, n := range names {
+		f := findField(m, UpperFirstCharacter(n))
+		if f == nil || f.Type != adjustType(types[i], s.Messages) {
+			return nil
+		}
+		keys = append(keys, f)
+	}
+	return keys
+}
+
+func findField(m *Message, name string) *Field {
+	if m == nil {
+		return nil
+	}
+	for _, f := range m.Fields {
+		if UpperFirstCharacter(f.Name) == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Service) isGetterKey(f *Field) bool {
+	for _, k := range s.getterKeys {
+		if f == k {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldMaskInputGrpc reads the current row through the Get query and overrides the fields of the update_mask
+func (s *Service) fieldMaskInputGrpc(m *Message) []string {
+	in := s.InputNames[0]
+	res := make([]string, 0)
+	for _, k := range s.getterKeys {
+		attrName := UpperFirstCharacter(k.Name)
+		res = append(res, bindToGo("req", fmt.Sprintf("%s.%s", in, attrName), attrName, k.Type, false, s.overrides)...)
+	}
+
+	args := make([]string, 0, len(s.getterKeys))
+	for _, k := range s.getterKeys {
+		args = append(args, fmt.Sprintf("%s.%s", in, UpperFirstCharacter(k.Name)))
+	}
+	params := strings.Join(args, ", ")
+	if s.getter.HasCustomParams() {
+		typ := s.getter.InputTypes[0]
+		fields := make([]string, 0, len(s.getterKeys))
+		for _, a := range args {
+			fields = append(fields, fmt.Sprintf("%s: %s", a[len(in)+1:], a))
+		}
+		if strings.HasPrefix(typ, "*") {
+			typ = "&" + typ[1:]
+		}
+		params = fmt.Sprintf("%s{%s}", typ, strings.Join(fields, ", "))
+	}
+	db := ""
+	if s.dbArgument {
+		db = ", s.db"
+	}
+	res = append(res, fmt.Sprintf("current, err := s.querier.%s(ctx%s, %s)", s.getter.Query, db, params))
+	res = append(res, "if err != nil {")
+	res = append(res, fmt.Sprintf("s.logger.Error(\"%s sql call failed\", zap.Error(err))", s.getter.Name))
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+	res = append(res, "paths, err := fieldmask.Paths(req, req.GetUpdateMask())")
+	res = append(res, "if err != nil {")
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+
+	out := s.Messages[canonicalName(s.getter.Output)]
+	for _, f := range m.Fields {
+		if f.Name == updateMaskField || s.isGetterKey(f) {
+			continue
+		}
+		attrName := UpperFirstCharacter(f.Name)
+		bind := bindToGo("req", fmt.Sprintf("%s.%s", in, attrName), attrName, f.Type, false, s.overrides)
+		col := findField(out, attrName)
+		if col == nil || col.Type != f.Type {
+			// params without a column are always read from the request
+			res = append(res, bind...)
+			continue
+		}
+		res = append(res, fmt.Sprintf("if paths[%q] {", ToSnakeCase(f.Name)))
+		res = append(res, bind...)
+		res = append(res, "} else {")
+		res = append(res, fmt.Sprintf("%s.%s = current.%s", in, attrName, attrName))
+		res = append(res, "}")
+	}
+	return res
+}
+
+// HasFieldMask checks if any package has a partial update method
+func (d *Definition) HasFieldMask() bool {
+	for _, p := range d.Packages {
+		if p.HasFieldMask() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Package) HasFieldMask() bool {
+	for _, s := range p.Services {
+		if s.FieldMask {
+			return true
+		}
+	}
+	return false
+}
@@ -2,20 +2,35 @@ package metadata
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"unicode"
+
+	"github.com/jinzhu/inflection"
 )
 
 func (s *Service) HttpMethod() string {
-	query := trimHeaderComments(strings.ReplaceAll(s.Sql, "`", ""))
-	query = strings.ToUpper(query)
-	if strings.HasPrefix(query, "SELECT ") && s.HasSimpleParams() {
+	if m := s.directives["method"]; m != "" {
+		return m
+	}
+	if s.routing != nil {
+		return s.resourceHttpMethod()
+	}
+	return s.defaultHttpMethod()
+}
+
+func (s *Service) defaultHttpMethod() string {
+	command := sqlCommand(s.Sql)
+	if command == "SELECT" && !s.ClientStreaming && !s.Batch && s.hasQueryStringParams() {
 		return "get"
 	}
-	if strings.HasPrefix(query, "DELETE ") && s.HasSimpleParams() {
+	if command == "DELETE" && s.HasSimpleParams() {
 		return "delete"
 	}
-	if strings.HasPrefix(query, "UPDATE ") {
+	if s.FieldMask {
+		return "patch"
+	}
+	if command == "UPDATE" {
 		return "put"
 	}
 
@@ -34,10 +49,88 @@ func trimHeaderComments(s string) string {
 	return strings.TrimSpace(s)
 }
 
+var sqlCommandPattern = regexp.MustCompile(`^(SELECT|INSERT|UPDATE|DELETE|WITH)\s`)
+
+// sqlCommand returns the command of the query, like UPDATE, skipping the header comments and the common table expressions
+func sqlCommand(sql string) string {
+	query := strings.TrimSpace(strings.ToUpper(removeComments(strings.ReplaceAll(sql, "`", ""))))
+	m := sqlCommandPattern.FindStringSubmatch(query)
+	if m == nil {
+		return ""
+	}
+	if m[1] != "WITH" {
+		return m[1]
+	}
+	// the main statement is the first command outside the parentheses of the CTEs
+	var depth int
+	var quoted bool
+	for i := len(m[0]); i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && !isWordChar(query[i-1]):
+			if m := sqlCommandPattern.FindStringSubmatch(query[i:]); m != nil && m[1] != "WITH" {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// removeComments replaces the -- and /* */ comments outside the string literals by a space
+func removeComments(sql string) string {
+	var sb strings.Builder
+	var quoted bool
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				return sb.String()
+			}
+			i += end
+			c = '\n'
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return sb.String()
+			}
+			i += end + 3
+			c = ' '
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
 func (s *Service) HttpPath() string {
+	if path := s.directives["path"]; path != "" {
+		return path
+	}
+	if s.routing != nil {
+		return s.resourceHttpPath()
+	}
 	path := "/" + toKebabCase(removePrefix(s.Name))
+	if nested := s.defaultNestedPath(); nested != "" {
+		if s.sharedNestedPath {
+			return nested + path
+		}
+		return nested
+	}
 	method := s.HttpMethod()
-
 	if (method == "get" || method == "delete") &&
 		len(s.InputNames) == 1 && !s.HasCustomParams() && !s.HasArrayParams() {
 		path = fmt.Sprintf("%s/{%s}", path, ToSnakeCase(canonicalName(s.InputNames[0])))
@@ -45,11 +138,131 @@ func (s *Service) HttpPath() string {
 	return path
 }
 
+// defaultNestedPath returns the nested path of the get and delete methods identified by two or more ids
+func (s *Service) defaultNestedPath() string {
+	if s.directives["path"] != "" || s.routing != nil {
+		return ""
+	}
+	if method := s.HttpMethod(); method != "get" && method != "delete" {
+		return ""
+	}
+	if ids := s.pathIDs(); len(ids) > 1 {
+		return nestedPath(ids, toKebabCase)
+	}
+	return ""
+}
+
+// markSharedNestedPaths keeps the query name on the nested paths bound to more than one query with the same verb
+func (p *Package) markSharedNestedPaths() {
+	byRoute := make(map[string][]*Service)
+	for _, s := range p.Services {
+		if path := s.defaultNestedPath(); path != "" {
+			route := s.HttpMethod() + " " + path
+			byRoute[route] = append(byRoute[route], s)
+		}
+	}
+	for _, services := range byRoute {
+		if len(services) > 1 {
+			for _, s := range services {
+				s.sharedNestedPath = true
+			}
+		}
+	}
+}
+
+// requestFields returns the proto field names of the request and their Go types
+func (s *Service) requestFields() ([]string, []string) {
+	names, types := make([]string, 0), make([]string, 0)
+	if s.HasCustomParams() {
+		if m, ok := s.Messages[canonicalName(s.InputTypes[0])]; ok {
+			for _, f := range m.Fields {
+				names = append(names, ToSnakeCase(f.Name))
+				types = append(types, f.Type)
+			}
+		}
+		return names, types
+	}
+	for i, n := range s.InputNames {
+		names = append(names, ToSnakeCase(canonicalName(n)))
+		types = append(types, adjustType(s.InputTypes[i], s.Messages))
+	}
+	return names, types
+}
+
+// pathIDs returns the request fields named <entity>_id that can be bound to the path
+func (s *Service) pathIDs() []string {
+	res := make([]string, 0)
+	names, types := s.requestFields()
+	for i, n := range names {
+		if strings.HasSuffix(n, "_id") && pathType(types[i], s.overrides) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// nestedPath binds each id to the collection of its entity, like /authors/{author_id}/books/{book_id}
+func nestedPath(ids []string, collectionCase func(string) string) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		sb.WriteString(fmt.Sprintf("/%s/{%s}", collectionCase(collectionOf(id)), id))
+	}
+	return sb.String()
+}
+
+// collectionOf returns the collection of the resources identified by the field, like Authors for author_id
+func collectionOf(id string) string {
+	return structName(inflection.Plural(strings.TrimSuffix(id, "_id")))
+}
+
+// hasQueryStringParams checks if all the request fields can be bound to the query string of a GET
+func (s *Service) hasQueryStringParams() bool {
+	_, types := s.requestFields()
+	for _, t := range types {
+		if !queryStringType(t, s.overrides) {
+			return false
+		}
+	}
+	return s.EmptyInput() || len(types) > 0
+}
+
+// queryStringType checks if grpc-gateway binds the type from the query string: scalars, enums, timestamps, wrappers and repeated scalars or enums
+func queryStringType(typ string, overrides *typeOverrides) bool {
+	repeated := strings.HasPrefix(typ, "[]") && typ != "[]byte"
+	if repeated {
+		typ = typ[2:]
+	}
+	if pathType(typ, overrides) {
+		return true
+	}
+	protoType := toProtoType(typ, overrides)
+	return !repeated && (protoType == "google.protobuf.Timestamp" ||
+		strings.HasPrefix(protoType, "google.protobuf.") && strings.HasSuffix(protoType, "Value"))
+}
+
+// pathType checks if the type can be bound to a path variable
+func pathType(typ string, overrides *typeOverrides) bool {
+	if isEnumType(typ) {
+		return !strings.HasPrefix(typ, "[]")
+	}
+	switch toProtoType(typ, overrides) {
+	case "double", "float", "int32", "int64", "uint32", "uint64", "bool", "string", "bytes":
+		return true
+	}
+	return false
+}
+
 func (s *Service) HttpBody() string {
+	if body, ok := s.directives["body"]; ok {
+		return body
+	}
 	switch s.HttpMethod() {
 	case "get", "delete":
 		return ""
 	default:
+		if s.ClientStreaming || s.Batch {
+			return "*"
+		}
 		if s.HasArrayParams() {
 			return s.InputNames[0]
 		}
@@ -58,6 +271,9 @@ func (s *Service) HttpBody() string {
 }
 
 func (s *Service) HttpResponseBody() string {
+	if s.ServerStreaming || s.Batch || s.Paginated {
+		return ""
+	}
 	if s.HasArrayOutput() {
 		return "list"
 	} else if s.HasCustomOutput() {
@@ -66,25 +282,67 @@ func (s *Service) HttpResponseBody() string {
 	return ""
 }
 
+// HttpOptions returns the options of the RPC. The options of the proto file are kept, the google.api.http option
+// is rebuilt only for new RPCs or when the directives or the streaming of the RPC change the route.
 func (s *Service) HttpOptions() []string {
-	if len(s.CustomProtoOptions) > 0 {
-		return s.CustomProtoOptions
-	}
 	res := make([]string, 0)
-	res = append(res, "option (google.api.http) = {")
-	res = append(res, fmt.Sprintf("    %s: \"%s\"", s.HttpMethod(), s.HttpPath()))
-	body := s.HttpBody()
-	if body != "" {
-		res = append(res, fmt.Sprintf("    body: \"%s\"", body))
+	keep := s.keepHttpOptions()
+	if keep {
+		res = append(res, s.protoHttpOptions...)
+	} else if !s.Internal() {
+		res = append(res, "option (google.api.http) = {")
+		res = append(res, fmt.Sprintf("    %s: \"%s\"", s.HttpMethod(), s.HttpPath()))
+		body := s.HttpBody()
+		if body != "" {
+			res = append(res, fmt.Sprintf("    body: \"%s\"", body))
+		}
+		responseBody := s.HttpResponseBody()
+		if responseBody != "" {
+			res = append(res, fmt.Sprintf("    response_body: \"%s\"", responseBody))
+		}
+		res = append(res, "};")
 	}
-	responseBody := s.HttpResponseBody()
-	if responseBody != "" {
-		res = append(res, fmt.Sprintf("    response_body: \"%s\"", responseBody))
+	res = append(res, s.CustomProtoOptions...)
+	if s.Deprecated() && !contains(res, deprecatedOption) {
+		res = append(res, deprecatedOption)
+	}
+	if s.Internal() && !keep {
+		res = append(res, internalOption)
 	}
-	res = append(res, "};")
 	return res
 }
 
+// keepHttpOptions checks if the route of the existing proto file still applies
+func (s *Service) keepHttpOptions() bool {
+	if s.protoRPC == nil {
+		return false
+	}
+	for _, k := range []string{"method", "path", "body"} {
+		if s.hasDirective(k) {
+			return false
+		}
+	}
+	if s.Internal() != contains(s.protoHttpOptions, internalOption) {
+		return false
+	}
+	return s.protoRPC.StreamsRequest == (s.ClientStreaming || s.Batch) && s.protoRPC.StreamsReturns == (s.ServerStreaming || s.Batch)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	deprecatedOption = "option deprecated = true;"
+	// hides the method from the OpenAPI spec (the gateway route is blocked by the server)
+	internalOption = `option (google.api.method_visibility).restriction = "INTERNAL";`
+)
+
 func removePrefix(s string) string {
 	p := prefix(s)
 	if p == s {
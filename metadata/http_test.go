@@ -0,0 +1,50 @@
+package metadata
+
+import "testing"
+
+func TestSqlCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{name: "select", sql: "SELECT * FROM books", want: "SELECT"},
+		{name: "lower case", sql: "delete from books where id = $1", want: "DELETE"},
+		{name: "sqlc header", sql: "`-- name: DeleteBook :exec\nDELETE FROM books WHERE id = $1\n`", want: "DELETE"},
+		{name: "leading comments", sql: "-- name: UpdateBook :exec\n-- grpc: method=patch\n-- updates the title\nUPDATE books SET title = $1", want: "UPDATE"},
+		{name: "leading block comment", sql: "/* the titles */\nUPDATE books SET title = $1", want: "UPDATE"},
+		{name: "newline after the verb", sql: "INSERT\nINTO books (title) VALUES ($1)", want: "INSERT"},
+		{name: "tab after the verb", sql: "UPDATE\tbooks SET title = $1", want: "UPDATE"},
+		{name: "with select", sql: "WITH t AS (SELECT 1) SELECT * FROM t", want: "SELECT"},
+		{
+			name: "with update",
+			sql:  "WITH old AS (\n  SELECT id FROM books WHERE year < $1\n)\nUPDATE books SET available = false FROM old WHERE books.id = old.id",
+			want: "UPDATE",
+		},
+		{
+			name: "with delete",
+			sql:  "WITH RECURSIVE tree(id) AS (SELECT $1::bigint UNION SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id)\nDELETE FROM categories WHERE id IN (SELECT id FROM tree)",
+			want: "DELETE",
+		},
+		{
+			name: "with many ctes",
+			sql:  "WITH a AS (SELECT 1), b AS (INSERT INTO logs (msg) VALUES ('delete (all)') RETURNING id)\nDELETE\nFROM books",
+			want: "DELETE",
+		},
+		{
+			name: "with comments",
+			sql:  "WITH a AS (\n  -- the author's books (old)\n  SELECT id FROM books /* isn't it ) */\n)\nUPDATE books SET title = $1 FROM a",
+			want: "UPDATE",
+		},
+		{name: "column named like a command", sql: "WITH a AS (SELECT 1 AS update_count) SELECT update_count FROM a", want: "SELECT"},
+		{name: "unknown", sql: "TRUNCATE books", want: ""},
+		{name: "verb prefix", sql: "SELECTED", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlCommand(tt.sql); got != tt.want {
+				t.Errorf("sqlCommand(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// iteratorBody rewrites the body of a sqlc :many method to call fn for each scanned row instead of collecting them on a slice.
+// It returns an empty string if the body doesn't look like the code generated by sqlc.
+func iteratorBody(fset *token.FileSet, fun *ast.FuncDecl) string {
+	if fun.Body == nil {
+		return ""
+	}
+	var appends int
+	node := astutil.Apply(fun.Body, nil, func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.DeclStmt:
+			// var items []T
+			if gen, ok := n.Decl.(*ast.GenDecl); ok && gen.Tok == token.VAR && len(gen.Specs) == 1 {
+				if vs, ok := gen.Specs[0].(*ast.ValueSpec); ok && len(vs.Names) == 1 && vs.Names[0].Name == "items" {
+					c.Delete()
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 || !isIdent(n.Lhs[0], "items") {
+				return true
+			}
+			// items = append(items, i)
+			if call, ok := n.Rhs[0].(*ast.CallExpr); ok && isIdent(call.Fun, "append") && len(call.Args) == 2 {
+				appends++
+				c.Replace(&ast.IfStmt{
+					Init: &ast.AssignStmt{
+						Lhs: []ast.Expr{ast.NewIdent("err")},
+						Tok: token.DEFINE,
+						Rhs: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent("fn"), Args: []ast.Expr{call.Args[1]}}},
+					},
+					Cond: &ast.BinaryExpr{X: ast.NewIdent("err"), Op: token.NEQ, Y: ast.NewIdent("nil")},
+					Body: &ast.BlockStmt{List: []ast.Stmt{
+						&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("err")}},
+					}},
+				})
+				return true
+			}
+			// items := []T{}
+			c.Delete()
+		case *ast.ReturnStmt:
+			if len(n.Results) != 2 {
+				return true
+			}
+			// return items, nil
+			if isIdent(n.Results[0], "items") {
+				c.Replace(&ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent("nil")}})
+				return true
+			}
+			// return nil, err
+			c.Replace(&ast.ReturnStmt{Results: []ast.Expr{n.Results[1]}})
+		}
+		return true
+	})
+	if appends != 1 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	// the blank line left by the replaced return
+	body := buf.String()
+	if strings.HasSuffix(body, "\n\n}") {
+		body = strings.TrimSuffix(body, "\n\n}") + "\n}"
+	}
+	return body
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// iteratorBody writes the code to execute a :many query and call fn for each scanned row, like sqlc-gen-go does for database/sql and pgx.
+func (r *requestParser) iteratorBody(q *plugin.Query, inputNames []string, output string) string {
+	for _, p := range q.Params {
+		// sqlc.slice rewrites the query at runtime
+		if p.Column != nil && p.Column.IsSqlcSlice {
+			return ""
+		}
+	}
+	for _, c := range q.Columns {
+		if c.EmbedTable != nil {
+			return ""
+		}
+	}
+
+	args := []string{"ctx", lowerFirstCharacter(q.Name)}
+	if len(inputNames) == 1 && inputNames[0] == "arg" {
+		msg := r.pkg.Messages[q.Name+"Params"]
+		for i, f := range msg.Fields {
+			args = append(args, r.arrayArg("arg."+f.Name, q.Params[i].Column))
+		}
+	} else if len(inputNames) == 1 {
+		args = append(args, r.arrayArg(inputNames[0], q.Params[0].Column))
+	}
+
+	elem := strings.TrimPrefix(strings.TrimPrefix(output, "[]"), "*")
+	dest := make([]string, 0, len(q.Columns))
+	if len(q.Columns) == 1 {
+		dest = append(dest, r.arrayArg("&i", q.Columns[0]))
+	} else {
+		for i, f := range r.pkg.Messages[elem].Fields {
+			dest = append(dest, r.arrayArg("&i."+f.Name, q.Columns[i]))
+		}
+	}
+	item := "i"
+	if strings.HasPrefix(output, "[]*") {
+		item = "&i"
+	}
+
+	db := "q.db"
+	if r.opts.EmitDbArgument {
+		db = "db"
+	}
+
+	query := "QueryContext"
+	if r.pkg.SqlPackage != "" {
+		query = "Query"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	sb.WriteString(fmt.Sprintf("rows, err := %s.%s(%s)\n", db, query, strings.Join(args, ", ")))
+	sb.WriteString("if err != nil {\nreturn err\n}\n")
+	sb.WriteString("defer rows.Close()\n")
+	sb.WriteString("for rows.Next() {\n")
+	sb.WriteString(fmt.Sprintf("var i %s\n", goType(elem)))
+	sb.WriteString(fmt.Sprintf("if err := rows.Scan(%s); err != nil {\nreturn err\n}\n", strings.Join(dest, ", ")))
+	sb.WriteString(fmt.Sprintf("if err := fn(%s); err != nil {\nreturn err\n}\n", item))
+	sb.WriteString("}\n")
+	if r.pkg.SqlPackage == "" {
+		sb.WriteString("if err := rows.Close(); err != nil {\nreturn err\n}\n")
+	}
+	sb.WriteString("return rows.Err()\n")
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// arrayArg wraps the postgres arrays with pq.Array on database/sql, pgx supports them natively
+func (r *requestParser) arrayArg(expr string, col *plugin.Column) string {
+	if col != nil && col.IsArray && r.req.Settings.Engine == "postgresql" && r.pkg.SqlPackage == "" {
+		return fmt.Sprintf("pq.Array(%s)", expr)
+	}
+	return expr
+}
+
+func lowerFirstCharacter(str string) string {
+	for i, v := range str {
+		return strings.ToLower(string(v)) + str[i+1:]
+	}
+	return str
+}
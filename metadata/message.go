@@ -15,19 +15,104 @@ type Message struct {
 	Name                string
 	Fields              []*Field
 	IsArray             bool
+	IsEnum              bool
+	IsNullEnum          bool
 	ElementType         string
+	EnumValues          []*EnumValue
 	CustomProtoComments []string
 	CustomProtoOptions  []string
+	ReservedRanges      []proto.Range
+	ReservedNames       []string
+
+	// the request of a renamed RPC
+	requestName string
+	overrides   *typeOverrides
 }
 
 func (m *Message) ProtoAttributes() string {
 	var s strings.Builder
-	for i, f := range m.Fields {
-		s.WriteString(f.Proto(i + 1))
+	s.WriteString(m.protoReserved())
+	tag := m.maxFieldNumber()
+	for _, f := range m.Fields {
+		if f.Number == 0 {
+			tag = m.nextFieldNumber(tag)
+			f.Number = tag
+		}
+		s.WriteString(f.proto(f.Number, m.overrides))
+	}
+	return s.String()
+}
+
+func (m *Message) protoReserved() string {
+	var s strings.Builder
+	if len(m.ReservedRanges) > 0 {
+		ranges := make([]string, 0, len(m.ReservedRanges))
+		for _, r := range m.ReservedRanges {
+			ranges = append(ranges, r.SourceRepresentation())
+		}
+		s.WriteString(fmt.Sprintf("    reserved %s;\n", strings.Join(ranges, ", ")))
+	}
+	if len(m.ReservedNames) > 0 {
+		names := make([]string, 0, len(m.ReservedNames))
+		for _, n := range m.ReservedNames {
+			names = append(names, fmt.Sprintf("%q", n))
+		}
+		s.WriteString(fmt.Sprintf("    reserved %s;\n", strings.Join(names, ", ")))
 	}
 	return s.String()
 }
 
+// maxFieldNumber returns the highest field (or enum value) number already taken by an existing field or a reserved range.
+func (m *Message) maxFieldNumber() int {
+	var max int
+	for _, f := range m.Fields {
+		if f.Number > max {
+			max = f.Number
+		}
+	}
+	for _, v := range m.EnumValues {
+		if v.Number > max {
+			max = v.Number
+		}
+	}
+	for _, r := range m.ReservedRanges {
+		if !r.Max && r.To > max {
+			max = r.To
+		}
+	}
+	return max
+}
+
+// nextFieldNumber returns the first field number greater than tag that is not reserved.
+func (m *Message) nextFieldNumber(tag int) int {
+	tag++
+	for m.isReservedNumber(tag) {
+		tag++
+	}
+	return tag
+}
+
+func (m *Message) isReservedNumber(tag int) bool {
+	for _, r := range m.ReservedRanges {
+		if tag >= r.From && (r.Max || tag <= r.To) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Message) reserve(tag int, name string) {
+	if !m.isReservedNumber(tag) {
+		m.ReservedRanges = append(m.ReservedRanges, proto.Range{From: tag, To: tag})
+	}
+	for _, n := range m.ReservedNames {
+		if n == name {
+			return
+		}
+	}
+	m.ReservedNames = append(m.ReservedNames, name)
+}
+
 func (m *Message) adjustType(messages map[string]*Message) {
 	for _, f := range m.Fields {
 		f.Type = adjustType(f.Type, messages)
@@ -45,9 +130,22 @@ func (m *Message) loadOptions(protoMessage *proto.Message) {
 			m.CustomProtoOptions = append(m.CustomProtoOptions, "    };")
 		}
 
+		if r, ok := e.(*proto.Reserved); ok {
+			m.ReservedRanges = append(m.ReservedRanges, r.Ranges...)
+			m.ReservedNames = append(m.ReservedNames, r.FieldNames...)
+		}
+
 		if f, ok := e.(*proto.NormalField); ok {
+			var exists bool
 			for _, field := range m.Fields {
 				if ToSnakeCase(field.Name) == f.Name {
+					exists = true
+					if !wireCompatible(f, toProtoType(field.Type, m.overrides)) {
+						// the old number stays reserved, the name is released below as the field keeps it
+						m.reserve(f.Sequence, f.Name)
+					} else {
+						field.Number = f.Sequence
+					}
 					if f.Comment != nil {
 						field.CustomProtoComments = clearLines(f.Comment.Lines)
 					}
@@ -77,8 +175,56 @@ func (m *Message) loadOptions(protoMessage *proto.Message) {
 					break
 				}
 			}
+			if !exists {
+				m.reserve(f.Sequence, f.Name)
+			}
+		}
+	}
+
+	// a column added back with a previously dropped name gets a fresh number, but the name can't stay reserved
+	names := make([]string, 0, len(m.ReservedNames))
+	for _, n := range m.ReservedNames {
+		var inUse bool
+		for _, field := range m.Fields {
+			if ToSnakeCase(field.Name) == n {
+				inUse = true
+				break
+			}
 		}
+		if !inUse {
+			names = append(names, n)
+		}
+	}
+	m.ReservedNames = names
+}
+
+// wireCompatibleTypes are the groups of scalar types that decode each other's values (https://protobuf.dev/programming-guides/proto3/#updating)
+var wireCompatibleTypes = [][]string{
+	{"int32", "int64", "uint32", "uint64", "bool"},
+	{"sint32", "sint64"},
+	{"fixed32", "sfixed32"},
+	{"fixed64", "sfixed64"},
+	{"string", "bytes"},
+}
+
+// wireCompatible checks if the existing field can be read as the new proto type, otherwise the field gets a new number.
+// Enums and messages are compatible only with themselves.
+func wireCompatible(protoField *proto.NormalField, typ string) bool {
+	typ = strings.TrimPrefix(typ, "optional ")
+	repeated := strings.HasPrefix(typ, "repeated ")
+	typ = strings.TrimPrefix(typ, "repeated ")
+	if protoField.Repeated != repeated {
+		return false
+	}
+	if protoField.Type == typ {
+		return true
 	}
+	for _, group := range wireCompatibleTypes {
+		if contains(group, protoField.Type) && contains(group, typ) {
+			return true
+		}
+	}
+	return false
 }
 
 func createStructMessage(name string, s *ast.StructType) (*Message, error) {
@@ -133,6 +279,12 @@ func firstIsUpper(s string) bool {
 }
 
 func adjustType(typ string, messages map[string]*Message) string {
+	if m, ok := messages[strings.TrimPrefix(typ, "[]")]; ok && m.IsEnum {
+		return typ + "." + enumElementType
+	}
+	if m, ok := messages[typ]; ok && m.IsNullEnum {
+		return typ + "." + nullEnumElementType
+	}
 	if m, ok := messages[typ]; ok {
 		var prefix string
 		if m.IsArray {
@@ -166,7 +318,7 @@ func (m *Message) AdapterToGo(src, dst string) []string {
 	res := make([]string, 0)
 	for _, f := range m.Fields {
 		attrName := UpperFirstCharacter(f.Name)
-		res = append(res, bindToGo(src, fmt.Sprintf("%s.%s", dst, attrName), attrName, f.Type, false)...)
+		res = append(res, bindToGo(src, fmt.Sprintf("%s.%s", dst, attrName), attrName, f.Type, false, m.overrides)...)
 	}
 	return res
 }
@@ -174,11 +326,14 @@ func (m *Message) AdapterToGo(src, dst string) []string {
 func (m *Message) AdapterToProto(src, dst string) []string {
 	res := make([]string, 0)
 	for _, f := range m.Fields {
-		res = append(res, bindToProto(src, dst, UpperFirstCharacter(f.Name), f.Type)...)
+		res = append(res, bindToProto(src, dst, UpperFirstCharacter(f.Name), f.Type, m.overrides)...)
 	}
 	return res
 }
 
 func (m *Message) ProtoName() string {
+	if m.requestName != "" {
+		return m.requestName
+	}
 	return regexp.MustCompile("Params$").ReplaceAllString(m.Name, "Request")
 }
@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emicklei/proto"
+)
+
+func TestMessageFieldNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		proto  string
+		fields []*Field
+		want   string
+	}{
+		{
+			name:   "new message",
+			fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Title", Type: "string"}},
+			want:   "int64 id = 1; string title = 2;",
+		},
+		{
+			name:   "numbers kept",
+			proto:  "string title = 1; int64 id = 2;",
+			fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Title", Type: "string"}},
+			want:   "int64 id = 2; string title = 1;",
+		},
+		{
+			name:   "new field after the highest number",
+			proto:  "int64 id = 3; string title = 1;",
+			fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Isbn", Type: "string"}, {Name: "Title", Type: "string"}},
+			want:   "int64 id = 3; string isbn = 4; string title = 1;",
+		},
+		{
+			name:   "reserved numbers skipped",
+			proto:  "reserved 2 to 4, 6; reserved \"isbn\"; int64 id = 5;",
+			fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Title", Type: "string"}, {Name: "Year", Type: "int32"}},
+			want:   "reserved 2 to 4, 6; reserved \"isbn\"; int64 id = 5; string title = 7; int32 year = 8;",
+		},
+		{
+			name:   "dropped field reserved",
+			proto:  "int64 id = 1; string isbn = 2;",
+			fields: []*Field{{Name: "ID", Type: "int64"}},
+			want:   "reserved 2; reserved \"isbn\"; int64 id = 1;",
+		},
+		{
+			name:   "dropped name added back",
+			proto:  "reserved 2; reserved \"isbn\"; int64 id = 1;",
+			fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Isbn", Type: "string"}},
+			want:   "reserved 2; int64 id = 1; string isbn = 3;",
+		},
+		{
+			name:   "compatible scalar",
+			proto:  "int32 year = 1; bytes title = 2;",
+			fields: []*Field{{Name: "Year", Type: "int64"}, {Name: "Title", Type: "string"}},
+			want:   "int64 year = 1; string title = 2;",
+		},
+		{
+			name:   "string to int64",
+			proto:  "string year = 1; string title = 2;",
+			fields: []*Field{{Name: "Year", Type: "int64"}, {Name: "Title", Type: "string"}},
+			want:   "reserved 1; int64 year = 3; string title = 2;",
+		},
+		{
+			name:   "scalar to timestamp",
+			proto:  "int64 available = 1;",
+			fields: []*Field{{Name: "Available", Type: "time.Time"}},
+			want:   "reserved 1; google.protobuf.Timestamp available = 2;",
+		},
+		{
+			name:   "scalar to wrapper",
+			proto:  "int32 year = 1;",
+			fields: []*Field{{Name: "Year", Type: "sql.NullInt32"}},
+			want:   "reserved 1; google.protobuf.Int32Value year = 2;",
+		},
+		{
+			name:   "scalar to enum",
+			proto:  "string book_type = 1;",
+			fields: []*Field{{Name: "BookType", Type: "BookType.enum"}},
+			want:   "reserved 1; BookType book_type = 2;",
+		},
+		{
+			name:   "enum to scalar",
+			proto:  "BookType book_type = 1;",
+			fields: []*Field{{Name: "BookType", Type: "string"}},
+			want:   "reserved 1; string book_type = 2;",
+		},
+		{
+			name:   "same enum",
+			proto:  "BookType book_type = 1;",
+			fields: []*Field{{Name: "BookType", Type: "BookType.enum"}},
+			want:   "BookType book_type = 1;",
+		},
+		{
+			name:   "scalar to repeated",
+			proto:  "string tags = 1;",
+			fields: []*Field{{Name: "Tags", Type: "[]string"}},
+			want:   "reserved 1; repeated string tags = 2;",
+		},
+		{
+			name:   "new number skips the reserved ones",
+			proto:  "reserved 2; string year = 1;",
+			fields: []*Field{{Name: "Year", Type: "int32"}},
+			want:   "reserved 2, 1; int32 year = 3;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Name: "Book", Fields: tt.fields}
+			if tt.proto != "" {
+				def, err := proto.NewParser(strings.NewReader("syntax = \"proto3\";\nmessage Book {\n" + tt.proto + "\n}\n")).Parse()
+				if err != nil {
+					t.Fatal(err)
+				}
+				proto.Walk(def, proto.WithMessage(func(msg *proto.Message) {
+					m.loadOptions(msg)
+				}))
+			}
+			got := strings.Join(strings.Fields(m.ProtoAttributes()), " ")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// valuePlaceholder is replaced by the converted value on the expressions of the type overrides
+const valuePlaceholder = "$value"
+
+// TypeOverride converts a Go type without a native conversion, like decimal.Decimal or the go_type of the sqlc overrides
+type TypeOverride struct {
+	// GoType is the type as written on the sqlc code, like decimal.Decimal or *decimal.Decimal
+	GoType string
+	// ProtoType is the type of the proto fields, like string or google.type.Decimal. Without it, DBType only selects GoType
+	ProtoType string
+	// ProtoImport is the proto file declaring ProtoType, like google/type/decimal.proto
+	ProtoImport string
+	// GoImports are the packages used by the expressions
+	GoImports []string
+	// ToProto converts the Go $value to ProtoType, like $value.String()
+	ToProto string
+	// ToGo converts the proto $value to GoType, like decimal.NewFromString($value)
+	ToGo string
+	// ToGoError is true when ToGo returns the value and an error
+	ToGoError bool
+	// DBType selects GoType for the columns of this type on plugin mode, like the db_type of the sqlc overrides
+	DBType string
+	// Nullable applies DBType to the nullable columns instead of the not null ones
+	Nullable bool
+}
+
+// typeOverrides are the conversions registered for the Go types of a package
+type typeOverrides struct {
+	byGoType map[string]*TypeOverride
+	list     []*TypeOverride
+}
+
+// newTypeOverrides validates the overrides and indexes the conversions by GoType
+func newTypeOverrides(overrides []*TypeOverride) (*typeOverrides, error) {
+	res := typeOverrides{
+		byGoType: make(map[string]*TypeOverride),
+		list:     make([]*TypeOverride, 0, len(overrides)),
+	}
+	for _, o := range overrides {
+		if o.GoType == "" {
+			return nil, fmt.Errorf("type override: go_type is required")
+		}
+		o := *o
+		res.list = append(res.list, &o)
+		if o.ProtoType == "" {
+			// only selects the Go type of the columns, with the built-in conversion
+			if o.DBType == "" {
+				return nil, fmt.Errorf("type override %q: proto_type is required", o.GoType)
+			}
+			continue
+		}
+		if o.ToProto == "" {
+			o.ToProto = valuePlaceholder
+		}
+		if o.ToGo == "" {
+			o.ToGo = valuePlaceholder
+		}
+		if _, ok := res.byGoType[o.GoType]; ok {
+			return nil, fmt.Errorf("type override: duplicated go_type %q", o.GoType)
+		}
+		res.byGoType[o.GoType] = &o
+	}
+	return &res, nil
+}
+
+// get returns the conversion of the Go type
+func (t *typeOverrides) get(goType string) (*TypeOverride, bool) {
+	if t == nil {
+		return nil, false
+	}
+	o, ok := t.byGoType[goType]
+	return o, ok
+}
+
+// find returns the conversion of the type or of its element type, like decimal.Decimal for []decimal.Decimal
+func (t *typeOverrides) find(typ string) (*TypeOverride, bool) {
+	for {
+		if o, ok := t.get(typ); ok {
+			return o, true
+		}
+		switch {
+		case strings.HasPrefix(typ, "*"):
+			typ = typ[1:]
+		case strings.HasPrefix(typ, "[]") && typ != "[]byte":
+			typ = typ[2:]
+		default:
+			return nil, false
+		}
+	}
+}
+
+// GoImports are the import specs of the packages used by the conversions of the type overrides
+func (p *Package) GoImports() []string {
+	res := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, o := range p.usedOverrides() {
+		for _, i := range o.GoImports {
+			// a path or an alias and a path, like dec github.com/shopspring/decimal
+			spec := fmt.Sprintf("%q", i)
+			if alias, path, ok := strings.Cut(i, " "); ok {
+				spec = fmt.Sprintf("%s %q", alias, strings.TrimSpace(path))
+			}
+			if !seen[spec] {
+				seen[spec] = true
+				res = append(res, spec)
+			}
+		}
+	}
+	return res
+}
+
+// usedOverrides returns the conversions of the Go types of the package
+func (p *Package) usedOverrides() []*TypeOverride {
+	res := make([]*TypeOverride, 0)
+	if p.overrides == nil {
+		return res
+	}
+	for _, o := range p.overrides.list {
+		if o.ProtoType == "" {
+			continue
+		}
+		if p.hasGoType(func(typ string) bool {
+			used, ok := p.overrides.find(typ)
+			return ok && used == o
+		}) {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// goType is the GoType of the override matching the database type of the column
+func (t *typeOverrides) goType(dbType string, notNull bool) string {
+	if t == nil {
+		return ""
+	}
+	dbType = strings.TrimPrefix(strings.ToLower(dbType), "pg_catalog.")
+	for _, o := range t.list {
+		if o.DBType != "" && strings.TrimPrefix(strings.ToLower(o.DBType), "pg_catalog.") == dbType && o.Nullable == !notNull {
+			return o.GoType
+		}
+	}
+	return ""
+}
+
+func overrideExpr(expr, value string) string {
+	return strings.ReplaceAll(expr, valuePlaceholder, value)
+}
+
+func overrideToProto(o *TypeOverride, src, dst string) []string {
+	return []string{fmt.Sprintf("%s = %s", dst, overrideExpr(o.ToProto, src))}
+}
+
+func overrideToGo(o *TypeOverride, src, dst, attrName string, newVar bool) []string {
+	res := make([]string, 0)
+	value := overrideExpr(o.ToGo, fmt.Sprintf("%s.Get%s()", src, camelCaseProto(attrName)))
+	if !o.ToGoError {
+		if newVar {
+			res = append(res, fmt.Sprintf("%s := %s", dst, value))
+		} else {
+			res = append(res, fmt.Sprintf("%s = %s", dst, value))
+		}
+		return res
+	}
+	if newVar {
+		res = append(res, fmt.Sprintf("var %s %s", dst, o.GoType))
+	}
+	res = append(res, fmt.Sprintf("if v, err := %s; err != nil {", value))
+	res = append(res, fmt.Sprintf("err = fmt.Errorf(\"invalid %s: %%s%%w\", err.Error(), validation.ErrUserInput)", attrName))
+	res = append(res, fmt.Sprintf("return nil, err } else { %s = v }", dst))
+	return res
+}
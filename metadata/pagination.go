@@ -0,0 +1,330 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// request and response fields of the paginated list RPCs (https://google.aip.dev/158)
+const (
+	pageSizeField      = "PageSize"
+	pageTokenField     = "PageToken"
+	nextPageTokenField = "next_page_token"
+)
+
+const defaultMaxPageSize = 100
+
+func maxPageSize(opts PackageOpts) int {
+	if opts.MaxPageSize > 0 {
+		return opts.MaxPageSize
+	}
+	return defaultMaxPageSize
+}
+
+// pageKey is a column of the ORDER BY of a keyset paginated query and the param compared with it
+type pageKey struct {
+	column *Field
+	param  *Field
+	// the field of a sql.Null* param, like String for sql.NullString
+	nullField string
+}
+
+// paginate replaces the LIMIT and OFFSET params of a :many query by the page_size and page_token fields.
+// The queries with the directive "paginate=keyset" replace the params compared with the ORDER BY columns instead of the OFFSET.
+func (s *Service) paginate() error {
+	keyset := s.directives["paginate"] == "keyset"
+	if s.ServerStreaming || !s.HasArrayOutput() || !s.HasCustomParams() || queryCommand(s.Sql) != ":many" {
+		if keyset {
+			return fmt.Errorf("%s: keyset pagination: only the :many queries with params can be paginated", s.Query)
+		}
+		return nil
+	}
+	m, ok := s.Messages[canonicalName(s.InputTypes[0])]
+	if !ok {
+		return nil
+	}
+	for _, f := range m.Fields {
+		switch {
+		case f.Name == "Limit" && isInteger(f.Type):
+			s.pageLimit = f
+		case f.Name == "Offset" && isInteger(f.Type):
+			s.pageOffset = f
+		}
+	}
+	if s.pageLimit == nil {
+		if keyset {
+			return fmt.Errorf("%s: keyset pagination: the query must have a LIMIT param", s.Query)
+		}
+		return nil
+	}
+	if keyset {
+		s.pageOffset = nil
+		keys, err := s.keysetParams(m)
+		if err != nil {
+			return fmt.Errorf("%s: keyset pagination: %w", s.Query, err)
+		}
+		s.pageKeys = keys
+	} else if s.pageOffset == nil {
+		return nil
+	}
+
+	fields := make([]*Field, 0, len(m.Fields))
+	for _, f := range m.Fields {
+		if !s.isPaginationParam(f) {
+			fields = append(fields, f)
+		}
+	}
+	s.Paginated = true
+	m.Fields = append(fields, &Field{Name: pageSizeField, Type: "int32"}, &Field{Name: pageTokenField, Type: "string"})
+	return nil
+}
+
+func (s *Service) isPaginationParam(f *Field) bool {
+	if f == s.pageLimit || f == s.pageOffset {
+		return true
+	}
+	for _, k := range s.pageKeys {
+		if f == k.param {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	orderByPattern = regexp.MustCompile(`(?is)\bORDER\s+BY\s+(.+?)(?:\bLIMIT\b|\bOFFSET\b|\bFOR\b|;|$)`)
+	// book_id > $1 or (title, book_id) > ($1, $2::bigint)
+	comparisonPattern    = regexp.MustCompile(`([\w.]+)\s*[<>]=?\s*\$(\d+)`)
+	rowComparisonPattern = regexp.MustCompile(`\(([\w.,\s]+)\)\s*[<>]=?\s*\(([$\w:,\s]+)\)`)
+	sortOrderPattern     = regexp.MustCompile(`(?i)\s+(ASC|DESC|NULLS\s+FIRST|NULLS\s+LAST)\b.*$`)
+	identifierPattern    = regexp.MustCompile(`^\w+$`)
+	// $1 IS NULL or $1::bigint IS NULL
+	isNullPattern       = regexp.MustCompile(`(?i)\$(\d+)(?:\s*::\s*[\w.]+(?:\[\])?)?\s+IS\s+NULL\b`)
+	questionMarkPattern = regexp.MustCompile(`\?`)
+)
+
+var errKeysetComparison = errors.New("the ORDER BY columns must be compared with params (like book_id > $1)")
+
+// keysetParams binds the ORDER BY columns to the params they are compared with.
+// The first page binds NULL to the params, so they must be nullable and the query must skip the comparison when they are NULL.
+func (s *Service) keysetParams(m *Message) ([]*pageKey, error) {
+	out, ok := s.Messages[canonicalName(s.Output)]
+	if !ok {
+		return nil, errKeysetComparison
+	}
+	query := positionalParams(trimHeaderComments(strings.ReplaceAll(s.Sql, "`", "")))
+	matches := orderByPattern.FindAllStringSubmatch(query, -1)
+	if len(matches) == 0 {
+		return nil, errKeysetComparison
+	}
+
+	params := make(map[string]int)
+	for _, c := range comparisonPattern.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(c[2])
+		params[unqualified(c[1])] = n
+	}
+	for _, c := range rowComparisonPattern.FindAllStringSubmatch(query, -1) {
+		columns, values := strings.Split(c[1], ","), strings.Split(c[2], ",")
+		for i := 0; i < len(columns) && i < len(values); i++ {
+			value, _, _ := strings.Cut(strings.TrimSpace(values[i]), "::")
+			n, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(value), "$"))
+			params[unqualified(columns[i])] = n
+		}
+	}
+	nullChecks := make(map[int]bool)
+	for _, c := range isNullPattern.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(c[1])
+		nullChecks[n] = true
+	}
+
+	keys := make([]*pageKey, 0)
+	var skipsComparison bool
+	// the last ORDER BY is the one of the outer query
+	for _, col := range strings.Split(matches[len(matches)-1][1], ",") {
+		col = unqualified(sortOrderPattern.ReplaceAllString(strings.TrimSpace(col), ""))
+		if !identifierPattern.MatchString(col) {
+			return nil, errKeysetComparison
+		}
+		n, ok := params[col]
+		if !ok || n < 1 || n > len(m.Fields) {
+			return nil, errKeysetComparison
+		}
+		key := pageKey{param: m.Fields[n-1]}
+		for _, f := range out.Fields {
+			if f.Name == structName(col) {
+				key.column = f
+				break
+			}
+		}
+		if key.column == nil {
+			return nil, errKeysetComparison
+		}
+		if key.param.Type != key.column.Type {
+			key.nullField = nullValueField(key.param.Type, key.column.Type)
+			if key.nullField == "" {
+				return nil, fmt.Errorf("the param %s has type %s and can't hold the %s column %s", key.param.Name, key.param.Type, key.column.Type, col)
+			}
+		} else if !isNullType(key.param.Type) {
+			return nil, fmt.Errorf("the param %s must be nullable to start at the first page, like sqlc.narg(after)", key.param.Name)
+		}
+		skipsComparison = skipsComparison || nullChecks[n]
+		keys = append(keys, &key)
+	}
+	if !skipsComparison {
+		return nil, errors.New("the comparison must be skipped when the params are NULL on the first page, like (sqlc.narg(after)::bigint IS NULL OR id > sqlc.narg(after))")
+	}
+	return keys, nil
+}
+
+// pgtypeValueFields are the value fields of the pgx/v5 nullable types and the Go types they hold
+var pgtypeValueFields = map[string][2]string{
+	"pgtype.Bool":        {"Bool", "bool"},
+	"pgtype.Int2":        {"Int16", "int16"},
+	"pgtype.Int4":        {"Int32", "int32"},
+	"pgtype.Int8":        {"Int64", "int64"},
+	"pgtype.Float4":      {"Float32", "float32"},
+	"pgtype.Float8":      {"Float64", "float64"},
+	"pgtype.Text":        {"String", "string"},
+	"pgtype.Date":        {"Time", "time.Time"},
+	"pgtype.Timestamp":   {"Time", "time.Time"},
+	"pgtype.Timestamptz": {"Time", "time.Time"},
+}
+
+// nullValueField returns the field of the nullable param type holding a value of the column type, like String for sql.NullString and string
+func nullValueField(paramType, columnType string) string {
+	if f, ok := pgtypeValueFields[paramType]; ok {
+		if f[1] == columnType {
+			return f[0]
+		}
+		return ""
+	}
+	nullField := strings.TrimPrefix(paramType, "sql.Null")
+	if paramType != "sql.Null"+nullField || !strings.EqualFold(strings.TrimPrefix(columnType, "time."), nullField) {
+		return ""
+	}
+	return nullField
+}
+
+func isNullType(typ string) bool {
+	_, pgtype := pgtypeValueFields[typ]
+	return pgtype || strings.HasPrefix(typ, "sql.Null")
+}
+
+// positionalParams numbers the ? params of MySQL and SQLite like the $n of PostgreSQL
+func positionalParams(query string) string {
+	var n int
+	return questionMarkPattern.ReplaceAllStringFunc(query, func(string) string {
+		n++
+		return "$" + strconv.Itoa(n)
+	})
+}
+
+func unqualified(column string) string {
+	column = strings.TrimSpace(column)
+	return column[strings.LastIndex(column, ".")+1:]
+}
+
+func isInteger(typ string) bool {
+	switch typ {
+	case "int", "int16", "int32", "int64":
+		return true
+	}
+	return false
+}
+
+func isPageField(f *Field) bool {
+	return f.Name == pageSizeField || f.Name == pageTokenField
+}
+
+// paginationInputGrpc reads the page size and the page token, asking the database for one more row to know if there is a next page
+func (s *Service) paginationInputGrpc() []string {
+	in := s.InputNames[0]
+	res := make([]string, 0)
+	res = append(res, "pageSize, err := pagination.PageSize(req.GetPageSize(), maxPageSize)")
+	res = append(res, "if err != nil {")
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+	res = append(res, "requestHash, err := pagination.RequestHash(req)")
+	res = append(res, "if err != nil {")
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+	res = append(res, fmt.Sprintf("pageToken, err := pagination.Decode(%q, requestHash, req.GetPageToken())", s.Name))
+	res = append(res, "if err != nil {")
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+	if len(s.pageKeys) > 0 {
+		// the first page binds NULL to the keys
+		res = append(res, "if pageToken.Keys != nil {")
+		for i, k := range s.pageKeys {
+			if k.nullField == "" {
+				res = append(res, fmt.Sprintf("if err := pageToken.Key(%d, &%s.%s); err != nil {", i, in, k.param.Name))
+				res = append(res, "return nil, err")
+				res = append(res, "}")
+				continue
+			}
+			res = append(res, fmt.Sprintf("var key%d %s", i, k.column.Type))
+			res = append(res, fmt.Sprintf("if err := pageToken.Key(%d, &key%d); err != nil {", i, i))
+			res = append(res, "return nil, err")
+			res = append(res, "}")
+			res = append(res, fmt.Sprintf("%s.%s = %s{%s: key%d, Valid: true}", in, k.param.Name, k.param.Type, k.nullField, i))
+		}
+		res = append(res, "}")
+	} else {
+		res = append(res, fmt.Sprintf("%s.%s = %s(pageToken.Offset)", in, s.pageOffset.Name, s.pageOffset.Type))
+	}
+	res = append(res, fmt.Sprintf("%s.%s = %s(pageSize + 1)", in, s.pageLimit.Name, s.pageLimit.Type))
+	return res
+}
+
+// paginationOutputGrpc drops the extra row and sets the next page token
+func (s *Service) paginationOutputGrpc() []string {
+	res := make([]string, 0)
+	res = append(res, fmt.Sprintf("res := new(pb.%sResponse)", s.Name))
+	res = append(res, "if len(result) > int(pageSize) {")
+	res = append(res, "result = result[:pageSize]")
+	if len(s.pageKeys) > 0 {
+		values := make([]string, 0, len(s.pageKeys))
+		for _, k := range s.pageKeys {
+			values = append(values, "last."+k.column.Name)
+		}
+		res = append(res, "last := result[len(result)-1]")
+		res = append(res, fmt.Sprintf("keys, err := pagination.Keys(%s)", strings.Join(values, ", ")))
+		res = append(res, "if err != nil {")
+		res = append(res, "return nil, err")
+		res = append(res, "}")
+		res = append(res, fmt.Sprintf("res.NextPageToken, err = pagination.Encode(pagination.Token{Method: %q, Request: requestHash, Keys: keys})", s.Name))
+	} else {
+		res = append(res, fmt.Sprintf("res.NextPageToken, err = pagination.Encode(pagination.Token{Method: %q, Request: requestHash, Offset: pageToken.Offset + int64(pageSize)})", s.Name))
+	}
+	res = append(res, "if err != nil {")
+	res = append(res, "return nil, err")
+	res = append(res, "}")
+	res = append(res, "}")
+	res = append(res, "for _, r := range result {")
+	res = append(res, fmt.Sprintf("res.List = append(res.List, to%s(r))", canonicalName(s.Output)))
+	res = append(res, "}")
+	res = append(res, "return res, nil")
+	return res
+}
+
+// HasPagination checks if any package has a paginated method
+func (d *Definition) HasPagination() bool {
+	for _, p := range d.Packages {
+		if p.HasPagination() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Package) HasPagination() bool {
+	for _, s := range p.Services {
+		if s.Paginated {
+			return true
+		}
+	}
+	return false
+}
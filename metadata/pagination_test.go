@@ -0,0 +1,98 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeysetPagination(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		params []*Field
+		// the binding of the page token keys, empty if the query is rejected
+		want []string
+	}{
+		{
+			name:   "nullable param",
+			sql:    "SELECT id, name FROM authors WHERE ($1::bigint IS NULL OR id > $1) ORDER BY id LIMIT $2",
+			params: []*Field{{Name: "After", Type: "sql.NullInt64"}, {Name: "Limit", Type: "int32"}},
+			want:   []string{"var key0 int64", "arg.After = sql.NullInt64{Int64: key0, Valid: true}"},
+		},
+		{
+			name:   "row comparison",
+			sql:    "SELECT id, name FROM authors WHERE $1::text IS NULL OR (name, id) < ($1, $2::bigint) ORDER BY name DESC, id DESC LIMIT $3",
+			params: []*Field{{Name: "AfterName", Type: "sql.NullString"}, {Name: "AfterID", Type: "sql.NullInt64"}, {Name: "Limit", Type: "int32"}},
+			want: []string{
+				"var key0 string", "arg.AfterName = sql.NullString{String: key0, Valid: true}",
+				"var key1 int64", "arg.AfterID = sql.NullInt64{Int64: key1, Valid: true}",
+			},
+		},
+		{
+			name:   "pgx",
+			sql:    "SELECT id, name FROM authors WHERE $1::bigint IS NULL OR id > $1 ORDER BY id LIMIT $2",
+			params: []*Field{{Name: "After", Type: "pgtype.Int8"}, {Name: "Limit", Type: "int32"}},
+			want:   []string{"var key0 int64", "arg.After = pgtype.Int8{Int64: key0, Valid: true}"},
+		},
+		{
+			name:   "not null param",
+			sql:    "SELECT id, name FROM authors WHERE id > $1 ORDER BY id LIMIT $2",
+			params: []*Field{{Name: "ID", Type: "int64"}, {Name: "Limit", Type: "int32"}},
+		},
+		{
+			name:   "comparison not skipped",
+			sql:    "SELECT id, name FROM authors WHERE id > $1 ORDER BY id LIMIT $2",
+			params: []*Field{{Name: "After", Type: "sql.NullInt64"}, {Name: "Limit", Type: "int32"}},
+		},
+		{
+			name:   "other type",
+			sql:    "SELECT id, name FROM authors WHERE $1::text IS NULL OR id > $1 ORDER BY id LIMIT $2",
+			params: []*Field{{Name: "After", Type: "sql.NullString"}, {Name: "Limit", Type: "int32"}},
+		},
+		{
+			name:   "order by not compared",
+			sql:    "SELECT id, name FROM authors WHERE $1::bigint IS NULL OR id > $1 ORDER BY name, id LIMIT $2",
+			params: []*Field{{Name: "After", Type: "sql.NullInt64"}, {Name: "Limit", Type: "int32"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{
+				Name:       "ListAuthors",
+				InputNames: []string{"arg"},
+				InputTypes: []string{"ListAuthorsParams"},
+				Output:     "[]ListAuthorsRow",
+				Sql:        "-- name: ListAuthors :many\n" + tt.sql,
+				Messages: map[string]*Message{
+					"ListAuthorsParams": {Name: "ListAuthorsParams", Fields: tt.params},
+					"ListAuthorsRow":    {Name: "ListAuthorsRow", Fields: []*Field{{Name: "ID", Type: "int64"}, {Name: "Name", Type: "string"}}},
+				},
+				directives: map[string]string{"paginate": "keyset"},
+			}
+			err := s.paginate()
+			if len(tt.want) == 0 {
+				if err == nil || s.Paginated {
+					t.Fatalf("the query was paginated, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.Paginated {
+				t.Fatal("the query was not paginated")
+			}
+			got := strings.Join(s.paginationInputGrpc(), "\n")
+			for _, line := range tt.want {
+				if !strings.Contains(got, line) {
+					t.Errorf("%q not found on:\n%s", line, got)
+				}
+			}
+			for _, f := range s.Messages["ListAuthorsParams"].Fields {
+				if !isPageField(f) {
+					t.Errorf("the param %s is still on the request", f.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package metadata
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jinzhu/inflection"
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+	"github.com/sqlc-dev/plugin-sdk-go/sdk"
+)
+
+// ParseGenerateRequest creates a Package from the catalog and queries sent by sqlc to a codegen plugin.
+// The names and types follow the conventions of the code written by sqlc-gen-go, so the generated
+// services can call the sqlc Queries of the package at opts.Path.
+func ParseGenerateRequest(req *plugin.GenerateRequest, opts PackageOpts, queriesToIgnore []*regexp.Regexp) (*Package, error) {
+	if req.Settings == nil {
+		return nil, fmt.Errorf("missing sqlc settings")
+	}
+	overrides, err := newTypeOverrides(opts.TypeOverrides)
+	if err != nil {
+		return nil, err
+	}
+	pkgName := opts.Package
+	if pkgName == "" {
+		pkgName = filepath.Base(opts.Path)
+	}
+	p := Package{
+		Engine:             req.Settings.Engine,
+		SqlPackage:         sqlPackage(opts.SqlPackage),
+		Package:            pkgName,
+		SrcPath:            opts.Path,
+		Messages:           make(map[string]*Message),
+		EmitInterface:      opts.EmitInterface,
+		EmitParamsPointers: opts.EmitParamsPointers,
+		EmitResultPointers: opts.EmitResultPointers,
+		EmitDbArgument:     opts.EmitDbArgument,
+		CopyFromBatchSize:  copyFromBatchSize(opts),
+		MaxPageSize:        maxPageSize(opts),
+		serverStreaming:    opts.ServerStreaming,
+		zeroRowsNotFound:   opts.ZeroRowsNotFound,
+		fieldMask:          opts.FieldMask,
+		resourceMode:       opts.Resource,
+		exactTableNames:    opts.EmitExactTableNames,
+		overrides:          overrides,
+	}
+
+	r := requestParser{
+		req:         req,
+		opts:        opts,
+		pkg:         &p,
+		enums:       make(map[string]string),
+		tableModels: make(map[string]*Message),
+	}
+	r.parseCatalog()
+
+	for _, q := range req.Queries {
+		var ignore bool
+		for _, re := range queriesToIgnore {
+			if re.MatchString(q.Name) {
+				ignore = true
+				break
+			}
+		}
+		if ignore {
+			continue
+		}
+		if err := r.parseQuery(q); err != nil {
+			return nil, err
+		}
+	}
+
+	p.resolve()
+	if err := p.checkTypes(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+type requestParser struct {
+	req         *plugin.GenerateRequest
+	opts        PackageOpts
+	pkg         *Package
+	enums       map[string]string
+	tableModels map[string]*Message
+	tables      []*plugin.Identifier
+}
+
+func (r *requestParser) defaultSchema() string {
+	if r.req.Catalog != nil && r.req.Catalog.DefaultSchema != "" {
+		return r.req.Catalog.DefaultSchema
+	}
+	return "public"
+}
+
+func (r *requestParser) parseCatalog() {
+	if r.req.Catalog == nil {
+		return
+	}
+	for _, schema := range r.req.Catalog.Schemas {
+		if schema.Name == "pg_catalog" || schema.Name == "information_schema" {
+			continue
+		}
+		for _, enum := range schema.Enums {
+			name := enum.Name
+			if schema.Name != r.defaultSchema() {
+				name = schema.Name + "_" + name
+			}
+			goName := structName(name)
+			r.enums[schemaQualified(schema.Name, enum.Name, r.defaultSchema())] = goName
+			msg := &Message{
+				Name:        goName,
+				ElementType: "string",
+			}
+			for _, v := range enum.Vals {
+				msg.addEnumValue(structName(name+"_"+enumReplace(v)), v)
+			}
+			r.pkg.Messages[goName] = msg
+			r.pkg.Messages["Null"+goName] = &Message{
+				Name: "Null" + goName,
+				Fields: []*Field{
+					{Name: goName, Type: goName},
+					{Name: "Valid", Type: "bool"},
+				},
+			}
+		}
+	}
+	r.pkg.markNullEnums()
+	for _, schema := range r.req.Catalog.Schemas {
+		if schema.Name == "pg_catalog" || schema.Name == "information_schema" {
+			continue
+		}
+		for _, table := range schema.Tables {
+			name := table.Rel.Name
+			if !r.opts.EmitExactTableNames {
+				name = inflection.Singular(name)
+			}
+			if schema.Name != r.defaultSchema() {
+				name = schema.Name + "_" + name
+			}
+			msg := r.columnsToMessage(structName(name), table.Columns)
+			r.tableModels[schemaQualified(schema.Name, table.Rel.Name, r.defaultSchema())] = msg
+			r.tables = append(r.tables, &plugin.Identifier{Catalog: table.Rel.Catalog, Schema: schema.Name, Name: table.Rel.Name})
+			r.pkg.Messages[msg.Name] = msg
+		}
+	}
+}
+
+func (r *requestParser) parseQuery(q *plugin.Query) error {
+	batch := strings.HasPrefix(q.Cmd, ":batch")
+	if q.Name == "" || (batch && len(q.Params) == 0) {
+		return nil
+	}
+
+	inputNames := make([]string, 0)
+	inputTypes := make([]string, 0)
+	if len(q.Params) == 1 && q.Cmd != ":copyfrom" {
+		typ := r.goType(q.Params[0].Column)
+		if batch {
+			typ = "[]" + typ
+		}
+		inputNames = append(inputNames, paramName(q.Params[0]))
+		inputTypes = append(inputTypes, typ)
+	} else if len(q.Params) > 0 {
+		columns := make([]*plugin.Column, 0, len(q.Params))
+		for _, p := range q.Params {
+			columns = append(columns, p.Column)
+		}
+		msg := r.columnsToMessage(q.Name+"Params", columns)
+		r.pkg.Messages[msg.Name] = msg
+		typ := msg.Name
+		if r.opts.EmitParamsPointers {
+			typ = "*" + typ
+		}
+		if q.Cmd == ":copyfrom" || batch {
+			typ = "[]" + typ
+		}
+		inputNames = append(inputNames, "arg")
+		inputTypes = append(inputTypes, typ)
+	}
+
+	var output string
+	switch q.Cmd {
+	case ":one", ":many", ":batchone", ":batchmany":
+		if len(q.Columns) == 1 {
+			output = r.goType(q.Columns[0])
+		} else if len(q.Columns) > 1 {
+			output = r.outputStruct(q)
+			if r.opts.EmitResultPointers {
+				output = "*" + output
+			}
+		}
+		if output != "" && (q.Cmd == ":many" || q.Cmd == ":batchmany") {
+			output = "[]" + output
+		}
+	case ":execrows", ":execlastid", ":copyfrom":
+		output = "int64"
+	case ":execresult":
+		output = "sql.Result"
+		if r.pkg.SqlPackage != "" {
+			output = "pgconn.CommandTag"
+		}
+	}
+
+	var iterator string
+	if q.Cmd == ":many" && output != "" {
+		iterator = r.iteratorBody(q, inputNames, output)
+	}
+
+	sql := fmt.Sprintf("`-- name: %s %s\n%s\n`", q.Name, q.Cmd, q.Text)
+	return r.pkg.addService(q.Name, inputNames, inputTypes, output, sql, iterator, q.Comments)
+}
+
+// outputStruct returns the table model when the columns match all of its fields, otherwise it creates a <Query>Row message.
+func (r *requestParser) outputStruct(q *plugin.Query) string {
+	for _, table := range r.tables {
+		msg := r.tableModels[schemaQualified(table.Schema, table.Name, r.defaultSchema())]
+		if msg == nil || len(msg.Fields) != len(q.Columns) {
+			continue
+		}
+		same := true
+		for i, c := range q.Columns {
+			if !sdk.SameTableName(c.Table, table, r.defaultSchema()) ||
+				msg.Fields[i].Name != structName(columnName(c, i)) ||
+				msg.Fields[i].Type != r.goType(c) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return msg.Name
+		}
+	}
+	msg := r.columnsToMessage(q.Name+"Row", q.Columns)
+	r.pkg.Messages[msg.Name] = msg
+	return msg.Name
+}
+
+func (r *requestParser) columnsToMessage(name string, columns []*plugin.Column) *Message {
+	fields := make([]*Field, 0, len(columns))
+	seen := make(map[string]int)
+	for i, c := range columns {
+		fieldName := structName(columnName(c, i))
+		if n := seen[fieldName]; n > 0 {
+			seen[fieldName]++
+			fieldName = fmt.Sprintf("%s_%d", fieldName, n+1)
+		} else {
+			seen[fieldName] = 1
+		}
+		fields = append(fields, &Field{Name: fieldName, Type: r.goType(c)})
+	}
+	return &Message{
+		Name:   name,
+		Fields: fields,
+	}
+}
+
+func (r *requestParser) goType(col *plugin.Column) string {
+	typ := r.goInnerType(col)
+	if col.IsArray || col.IsSqlcSlice {
+		return "[]" + typ
+	}
+	if r.isNumeric(col) {
+		switch typ {
+		case "string":
+			return numericString
+		case "sql.NullString":
+			return numericNullString
+		}
+	}
+	return typ
+}
+
+// isNumeric checks if the column is a NUMERIC or DECIMAL without a type override
+func (r *requestParser) isNumeric(col *plugin.Column) bool {
+	dataType := strings.ToLower(sdk.DataType(col.Type))
+	if r.pkg.overrides.goType(dataType, col.NotNull) != "" {
+		return false
+	}
+	switch r.req.Settings.Engine {
+	case "mysql":
+		return dataType == "decimal" || dataType == "dec" || dataType == "fixed"
+	case "sqlite":
+		return false
+	}
+	return dataType == "numeric" || dataType == "pg_catalog.numeric"
+}
+
+func (r *requestParser) goInnerType(col *plugin.Column) string {
+	// arrays elements are not nullable on the Go code generated by sqlc
+	notNull := col.NotNull || col.IsArray
+	if typ := r.pkg.overrides.goType(sdk.DataType(col.Type), notNull); typ != "" {
+		return typ
+	}
+	var typ string
+	switch r.req.Settings.Engine {
+	case "mysql":
+		typ = mysqlType(col, notNull)
+	case "sqlite":
+		typ = sqliteType(col, notNull)
+	default:
+		if r.pkg.SqlPackage != "" {
+			typ = pgxType(col, notNull, r.pkg.SqlPackage)
+		}
+		if typ == "" {
+			typ = postgresType(col, notNull)
+		}
+	}
+	if typ != "" {
+		return typ
+	}
+	if col.Type != nil {
+		if enum, ok := r.enums[schemaQualified(col.Type.Schema, col.Type.Name, r.defaultSchema())]; ok {
+			if notNull {
+				return enum
+			}
+			return "Null" + enum
+		}
+	}
+	return "interface{}"
+}
+
+func postgresType(col *plugin.Column, notNull bool) string {
+	switch strings.ToLower(sdk.DataType(col.Type)) {
+	case "serial", "serial4", "pg_catalog.serial4", "integer", "int", "int4", "pg_catalog.int4":
+		return nullable("int32", "sql.NullInt32", notNull)
+	case "bigserial", "serial8", "pg_catalog.serial8", "bigint", "int8", "pg_catalog.int8", "interval", "pg_catalog.interval":
+		return nullable("int64", "sql.NullInt64", notNull)
+	case "smallserial", "serial2", "pg_catalog.serial2", "smallint", "int2", "pg_catalog.int2":
+		return nullable("int16", "sql.NullInt16", notNull)
+	case "float", "double precision", "float8", "pg_catalog.float8":
+		return nullable("float64", "sql.NullFloat64", notNull)
+	case "real", "float4", "pg_catalog.float4":
+		return nullable("float32", "sql.NullFloat64", notNull)
+	case "numeric", "pg_catalog.numeric", "money":
+		return nullable("string", "sql.NullString", notNull)
+	case "boolean", "bool", "pg_catalog.bool":
+		return nullable("bool", "sql.NullBool", notNull)
+	case "json", "jsonb":
+		return nullable("json.RawMessage", "pqtype.NullRawMessage", notNull)
+	case "bytea", "blob", "pg_catalog.bytea":
+		return "[]byte"
+	case "date", "pg_catalog.time", "pg_catalog.timetz", "timestamp", "pg_catalog.timestamp", "timestamptz", "pg_catalog.timestamptz":
+		return nullable("time.Time", "sql.NullTime", notNull)
+	case "text", "varchar", "pg_catalog.varchar", "pg_catalog.bpchar", "string", "citext", "name", "ltree", "lquery", "ltxtquery":
+		return nullable("string", "sql.NullString", notNull)
+	case "uuid":
+		return nullable("uuid.UUID", "uuid.NullUUID", notNull)
+	case "macaddr", "macaddr8":
+		return nullable("net.HardwareAddr", "pqtype.Macaddr", notNull)
+	case "inet":
+		return "pqtype.Inet"
+	case "cidr":
+		return "pqtype.CIDR"
+	}
+	return ""
+}
+
+// pgxType returns the types used by sqlc with sql_package pgx/v4 or pgx/v5, it's empty for the same types of database/sql
+func pgxType(col *plugin.Column, notNull bool, sqlPackage string) string {
+	dataType := strings.ToLower(sdk.DataType(col.Type))
+	if sqlPackage == "pgx/v4" {
+		switch dataType {
+		case "numeric", "pg_catalog.numeric", "money":
+			return "pgtype.Numeric"
+		case "json":
+			return "pgtype.JSON"
+		case "jsonb":
+			return "pgtype.JSONB"
+		case "inet":
+			return "pgtype.Inet"
+		case "cidr":
+			return "pgtype.CIDR"
+		case "macaddr", "macaddr8":
+			return "pgtype.Macaddr"
+		case "daterange":
+			return "pgtype.Daterange"
+		case "tsrange":
+			return "pgtype.Tsrange"
+		case "tstzrange":
+			return "pgtype.Tstzrange"
+		}
+		return ""
+	}
+	switch dataType {
+	case "serial", "serial4", "pg_catalog.serial4", "integer", "int", "int4", "pg_catalog.int4":
+		return nullable("int32", "pgtype.Int4", notNull)
+	case "bigserial", "serial8", "pg_catalog.serial8", "bigint", "int8", "pg_catalog.int8":
+		return nullable("int64", "pgtype.Int8", notNull)
+	case "smallserial", "serial2", "pg_catalog.serial2", "smallint", "int2", "pg_catalog.int2":
+		return nullable("int16", "pgtype.Int2", notNull)
+	case "float", "double precision", "float8", "pg_catalog.float8":
+		return nullable("float64", "pgtype.Float8", notNull)
+	case "real", "float4", "pg_catalog.float4":
+		return nullable("float32", "pgtype.Float4", notNull)
+	case "numeric", "pg_catalog.numeric", "money":
+		return "pgtype.Numeric"
+	case "boolean", "bool", "pg_catalog.bool":
+		return nullable("bool", "pgtype.Bool", notNull)
+	case "json", "jsonb":
+		return "[]byte"
+	case "date":
+		return "pgtype.Date"
+	case "pg_catalog.time":
+		return "pgtype.Time"
+	case "timestamp", "pg_catalog.timestamp":
+		return "pgtype.Timestamp"
+	case "timestamptz", "pg_catalog.timestamptz":
+		return "pgtype.Timestamptz"
+	case "interval", "pg_catalog.interval":
+		return "pgtype.Interval"
+	case "text", "varchar", "pg_catalog.varchar", "pg_catalog.bpchar", "string", "citext", "name", "ltree", "lquery", "ltxtquery":
+		return nullable("string", "pgtype.Text", notNull)
+	case "uuid":
+		return "pgtype.UUID"
+	case "inet":
+		return nullable("netip.Addr", "*netip.Addr", notNull)
+	case "cidr":
+		return nullable("netip.Prefix", "*netip.Prefix", notNull)
+	case "macaddr", "macaddr8":
+		return "net.HardwareAddr"
+	case "daterange":
+		return "pgtype.Range[pgtype.Date]"
+	case "tsrange":
+		return "pgtype.Range[pgtype.Timestamp]"
+	case "tstzrange":
+		return "pgtype.Range[pgtype.Timestamptz]"
+	}
+	return ""
+}
+
+func mysqlType(col *plugin.Column, notNull bool) string {
+	switch strings.ToLower(sdk.DataType(col.Type)) {
+	case "varchar", "text", "char", "tinytext", "mediumtext", "longtext", "decimal", "dec", "fixed", "enum", "set":
+		return nullable("string", "sql.NullString", notNull)
+	case "tinyint":
+		if col.Length == 1 {
+			return nullable("bool", "sql.NullBool", notNull)
+		}
+		return nullable("int32", "sql.NullInt32", notNull)
+	case "smallint", "year", "int", "integer", "mediumint":
+		return nullable("int32", "sql.NullInt32", notNull)
+	case "bigint":
+		return nullable("int64", "sql.NullInt64", notNull)
+	case "blob", "binary", "varbinary", "tinyblob", "mediumblob", "longblob":
+		return "[]byte"
+	case "double", "double precision", "real", "float":
+		return nullable("float64", "sql.NullFloat64", notNull)
+	case "date", "timestamp", "datetime", "time":
+		return nullable("time.Time", "sql.NullTime", notNull)
+	case "boolean", "bool":
+		return nullable("bool", "sql.NullBool", notNull)
+	case "json":
+		return "json.RawMessage"
+	}
+	return ""
+}
+
+func sqliteType(col *plugin.Column, notNull bool) string {
+	dt := strings.ReplaceAll(strings.ToLower(sdk.DataType(col.Type)), " ", "")
+	switch dt {
+	case "int", "integer", "tinyint", "smallint", "mediumint", "bigint", "unsignedbigint", "int2", "int8":
+		return nullable("int64", "sql.NullInt64", notNull)
+	case "blob":
+		return "[]byte"
+	case "real", "double", "doubleprecision", "float", "numeric":
+		return nullable("float64", "sql.NullFloat64", notNull)
+	case "boolean", "bool":
+		return nullable("bool", "sql.NullBool", notNull)
+	case "date", "datetime", "timestamp":
+		return nullable("time.Time", "sql.NullTime", notNull)
+	}
+	for _, prefix := range []string{"character", "varchar", "varyingcharacter", "nchar", "nativecharacter", "nvarchar", "text", "clob"} {
+		if strings.HasPrefix(dt, prefix) {
+			return nullable("string", "sql.NullString", notNull)
+		}
+	}
+	if strings.HasPrefix(dt, "decimal") {
+		return nullable("float64", "sql.NullFloat64", notNull)
+	}
+	return ""
+}
+
+func nullable(typ, nullType string, notNull bool) string {
+	if notNull {
+		return typ
+	}
+	return nullType
+}
+
+func schemaQualified(schema, name, defaultSchema string) string {
+	if schema == "" {
+		schema = defaultSchema
+	}
+	return schema + "." + name
+}
+
+func columnName(c *plugin.Column, pos int) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("column_%d", pos+1)
+}
+
+func paramName(p *plugin.Parameter) string {
+	if p.Column != nil && p.Column.Name != "" {
+		return argName(p.Column.Name)
+	}
+	return fmt.Sprintf("dollar_%d", p.Number)
+}
+
+func argName(name string) string {
+	out := ""
+	for i, p := range strings.Split(name, "_") {
+		if i == 0 {
+			out += strings.ToLower(p)
+		} else if p == "id" {
+			out += "ID"
+		} else {
+			out += strings.Title(p)
+		}
+	}
+	return out
+}
+
+var identPattern = regexp.MustCompile("[^a-zA-Z0-9_]+")
+
+// enumReplace cleans the enum values to be part of the Go constant names like sqlc does
+func enumReplace(value string) string {
+	id := strings.Replace(value, "-", "_", -1)
+	id = strings.Replace(id, ":", "_", -1)
+	id = strings.Replace(id, "/", "_", -1)
+	return identPattern.ReplaceAllString(id, "")
+}
+
+// structName converts a SQL identifier to a Go name like sqlc does
+func structName(name string) string {
+	out := ""
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return rune('_')
+	}, name)
+	for _, p := range strings.Split(name, "_") {
+		if p == "id" {
+			out += "ID"
+		} else {
+			out += strings.Title(p)
+		}
+	}
+	if r, _ := utf8.DecodeRuneInString(out); unicode.IsDigit(r) {
+		return "_" + out
+	}
+	return out
+}
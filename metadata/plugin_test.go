@@ -0,0 +1,100 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+func TestPluginGoType(t *testing.T) {
+	column := func(typ string, notNull bool) *plugin.Column {
+		return &plugin.Column{Name: "value", NotNull: notNull, Type: &plugin.Identifier{Name: typ}}
+	}
+	array := column("text", true)
+	array.IsArray = true
+	bit := column("tinyint", true)
+	bit.Length = 1
+	catalogEnum := &plugin.Column{Name: "value", NotNull: true, Type: &plugin.Identifier{Schema: "store", Name: "book_type"}}
+
+	tests := []struct {
+		engine     string
+		sqlPackage string
+		column     *plugin.Column
+		overrides  []*TypeOverride
+		want       string
+	}{
+		{engine: "postgresql", column: column("serial", true), want: "int32"},
+		{engine: "postgresql", column: column("pg_catalog.int4", false), want: "sql.NullInt32"},
+		{engine: "postgresql", column: column("bigserial", true), want: "int64"},
+		{engine: "postgresql", column: column("int2", false), want: "sql.NullInt16"},
+		{engine: "postgresql", column: column("real", false), want: "sql.NullFloat64"},
+		{engine: "postgresql", column: column("text", false), want: "sql.NullString"},
+		{engine: "postgresql", column: column("pg_catalog.varchar", true), want: "string"},
+		{engine: "postgresql", column: column("numeric", true), want: numericString},
+		{engine: "postgresql", column: column("pg_catalog.numeric", false), want: numericNullString},
+		{engine: "postgresql", column: column("money", true), want: "string"},
+		{engine: "postgresql", column: column("timestamptz", false), want: "sql.NullTime"},
+		{engine: "postgresql", column: column("jsonb", false), want: "pqtype.NullRawMessage"},
+		{engine: "postgresql", column: column("bytea", false), want: "[]byte"},
+		{engine: "postgresql", column: column("uuid", false), want: "uuid.NullUUID"},
+		{engine: "postgresql", column: column("inet", true), want: "pqtype.Inet"},
+		{engine: "postgresql", column: array, want: "[]string"},
+		{engine: "postgresql", column: column("book_type", true), want: "BookType"},
+		{engine: "postgresql", column: column("book_type", false), want: "NullBookType"},
+		{engine: "postgresql", column: catalogEnum, want: "StoreBookType"},
+		{engine: "postgresql", column: column("tsvector", true), want: "interface{}"},
+		{engine: "postgresql", column: column("numeric", true), overrides: []*TypeOverride{{GoType: "decimal.Decimal", DBType: "numeric"}}, want: "decimal.Decimal"},
+		{engine: "postgresql", column: column("numeric", false), overrides: []*TypeOverride{{GoType: "decimal.NullDecimal", DBType: "numeric", Nullable: true}}, want: "decimal.NullDecimal"},
+
+		{engine: "postgresql", sqlPackage: "pgx/v4", column: column("int4", false), want: "sql.NullInt32"},
+		{engine: "postgresql", sqlPackage: "pgx/v4", column: column("numeric", true), want: "pgtype.Numeric"},
+		{engine: "postgresql", sqlPackage: "pgx/v4", column: column("jsonb", true), want: "pgtype.JSONB"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("int8", false), want: "pgtype.Int8"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("int8", true), want: "int64"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("text", false), want: "pgtype.Text"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("numeric", true), want: "pgtype.Numeric"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("timestamptz", true), want: "pgtype.Timestamptz"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("inet", false), want: "*netip.Addr"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("jsonb", false), want: "[]byte"},
+		{engine: "postgresql", sqlPackage: "pgx/v5", column: column("tstzrange", true), want: "pgtype.Range[pgtype.Timestamptz]"},
+
+		{engine: "mysql", column: bit, want: "bool"},
+		{engine: "mysql", column: column("tinyint", false), want: "sql.NullInt32"},
+		{engine: "mysql", column: column("bigint", true), want: "int64"},
+		{engine: "mysql", column: column("varchar", false), want: "sql.NullString"},
+		{engine: "mysql", column: column("decimal", true), want: numericString},
+		{engine: "mysql", column: column("datetime", false), want: "sql.NullTime"},
+		{engine: "mysql", column: column("json", true), want: "json.RawMessage"},
+		{engine: "mysql", column: column("longblob", true), want: "[]byte"},
+
+		{engine: "sqlite", column: column("INTEGER", true), want: "int64"},
+		{engine: "sqlite", column: column("unsigned big int", false), want: "sql.NullInt64"},
+		{engine: "sqlite", column: column("varchar(255)", true), want: "string"},
+		{engine: "sqlite", column: column("numeric", true), want: "float64"},
+		{engine: "sqlite", column: column("decimal(10,2)", false), want: "sql.NullFloat64"},
+		{engine: "sqlite", column: column("datetime", true), want: "time.Time"},
+		{engine: "sqlite", column: column("blob", false), want: "[]byte"},
+	}
+	for _, tt := range tests {
+		overrides, err := newTypeOverrides(tt.overrides)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := requestParser{
+			req: &plugin.GenerateRequest{
+				Settings: &plugin.Settings{Engine: tt.engine},
+				Catalog: &plugin.Catalog{DefaultSchema: "public", Schemas: []*plugin.Schema{
+					{Name: "public", Enums: []*plugin.Enum{{Name: "book_type", Vals: []string{"FICTION"}}}},
+					{Name: "store", Enums: []*plugin.Enum{{Name: "book_type", Vals: []string{"FICTION"}}}},
+				}},
+			},
+			pkg:         &Package{SqlPackage: tt.sqlPackage, Messages: make(map[string]*Message), overrides: overrides},
+			enums:       make(map[string]string),
+			tableModels: make(map[string]*Message),
+		}
+		r.parseCatalog()
+		if got := r.goType(tt.column); got != tt.want {
+			t.Errorf("%s %s %s (not null %v) = %q, want %q", tt.engine, tt.sqlPackage, tt.column.Type.Name, tt.column.NotNull, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/inflection"
+)
+
+// standard methods of the resource-oriented APIs (https://google.aip.dev/130)
+const (
+	standardGet    = "get"
+	standardList   = "list"
+	standardCreate = "create"
+	standardUpdate = "update"
+	standardDelete = "delete"
+)
+
+// resource is a collection of the rows of a table, like /v1/books/{book_id} (https://google.aip.dev/121)
+type resource struct {
+	// the collection identifier, like books
+	collection string
+	// the plural and singular entity names on the query names, like Books and Book
+	plural   string
+	singular string
+	// the request fields identifying a resource, the parent ids first, like author_id and book_id
+	keys []string
+}
+
+// routing is the HTTP binding of a method on resource mode
+type routing struct {
+	resource *resource
+	standard string
+	// the name of the custom methods, like byTags on /v1/books:byTags (https://google.aip.dev/136)
+	custom string
+}
+
+var tablePattern = regexp.MustCompile(`(?is)^(?:INSERT\s+INTO|UPDATE|DELETE\s+FROM|SELECT\b.*?\bFROM)\s+([\w."]+)`)
+
+// queryTable returns the table that an INSERT, UPDATE, DELETE or SELECT query reads or writes
+func queryTable(sql string) string {
+	query := trimHeaderComments(strings.ReplaceAll(sql, "`", ""))
+	match := tablePattern.FindStringSubmatch(query)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(unqualified(strings.ReplaceAll(match[1], `"`, "")))
+}
+
+// groupResources groups the services by table, binding the standard methods to the collections and the other ones as custom methods
+func (p *Package) groupResources() {
+	resources := make(map[string]*resource)
+	for _, s := range p.Services {
+		table := queryTable(s.Sql)
+		if table == "" {
+			s.routing = &routing{custom: lowerFirstCharacter(s.Name)}
+			continue
+		}
+		r, ok := resources[table]
+		if !ok {
+			singular := inflection.Singular(table)
+			if p.exactTableNames {
+				singular = table
+			}
+			r = &resource{
+				collection: lowerFirstCharacter(structName(table)),
+				plural:     structName(table),
+				singular:   structName(singular),
+			}
+			resources[table] = r
+		}
+		s.routing = &routing{resource: r}
+	}
+
+	for _, r := range resources {
+		r.keys = p.resourceKeys(r)
+	}
+
+	for _, s := range p.Services {
+		if s.routing.resource != nil {
+			s.routing.standard = s.standardMethod()
+			if s.routing.standard == "" {
+				s.routing.custom = s.customMethodName()
+			}
+		}
+	}
+}
+
+// resourceKeys returns the params of the Get query of the resource or, without it, the id column of the model
+func (p *Package) resourceKeys(r *resource) []string {
+	for _, s := range p.Services {
+		if s.Name != "Get"+r.singular || s.EmptyInput() || s.HasArrayParams() || queryCommand(s.Sql) != ":one" {
+			continue
+		}
+		keys, _ := s.requestFields()
+		return ownKeyLast(keys, r.singular)
+	}
+	if m, ok := p.Messages[r.singular]; ok {
+		for _, key := range []string{"id", ToSnakeCase(r.singular) + "_id"} {
+			for _, f := range m.Fields {
+				if ToSnakeCase(f.Name) == key {
+					return []string{key}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ownKeyLast moves the id of the resource after the ids of its parents
+func ownKeyLast(keys []string, singular string) []string {
+	res := make([]string, 0, len(keys))
+	var own []string
+	for _, k := range keys {
+		if k == "id" || k == ToSnakeCase(singular)+"_id" {
+			own = append(own, k)
+		} else {
+			res = append(res, k)
+		}
+	}
+	return append(res, own...)
+}
+
+// parents returns the ids of the parent resources, like author_id on /v1/authors/{author_id}/books/{book_id}
+func (r *resource) parents() []string {
+	if len(r.keys) == 0 {
+		return nil
+	}
+	return r.keys[:len(r.keys)-1]
+}
+
+// hasKeys checks if the request identifies a resource. With exact it must have no other fields.
+func (s *Service) hasKeys(exact bool) bool {
+	keys := s.routing.resource.keys
+	return len(keys) > 0 && s.hasFields(keys, exact)
+}
+
+// hasFields checks if the request has all the fields. With exact it must have no other fields, besides the pagination and update_mask ones.
+func (s *Service) hasFields(keys []string, exact bool) bool {
+	names, _ := s.requestFields()
+	fields := make(map[string]bool)
+	for _, n := range names {
+		if n == updateMaskField || (s.Paginated && (n == ToSnakeCase(pageSizeField) || n == ToSnakeCase(pageTokenField))) {
+			continue
+		}
+		fields[n] = true
+	}
+	for _, k := range keys {
+		if !fields[k] {
+			return false
+		}
+	}
+	return !exact || len(fields) == len(keys)
+}
+
+func (s *Service) standardMethod() string {
+	r := s.routing.resource
+	verb := prefix(s.Name)
+	entity := s.Name[len(verb):]
+	command := sqlCommand(s.Sql)
+	if s.ServerStreaming || s.ClientStreaming || s.Batch {
+		return ""
+	}
+	switch strings.ToLower(verb) {
+	case "get", "read":
+		if entity == r.singular && command == "SELECT" && queryCommand(s.Sql) == ":one" && s.hasKeys(true) {
+			return standardGet
+		}
+	case "list":
+		if entity == r.plural && command == "SELECT" && queryCommand(s.Sql) == ":many" && (s.hasFields(nil, true) || s.hasFields(r.parents(), true)) {
+			return standardList
+		}
+	case "create", "add", "insert":
+		if entity == r.singular && command == "INSERT" {
+			return standardCreate
+		}
+	case "update", "modify":
+		if entity == r.singular && command == "UPDATE" && s.hasKeys(false) {
+			return standardUpdate
+		}
+	case "delete", "remove":
+		if entity == r.singular && command == "DELETE" && s.hasKeys(true) {
+			return standardDelete
+		}
+	}
+	return ""
+}
+
+// customMethodName removes the entity from the query name, like BooksByTags to byTags
+func (s *Service) customMethodName() string {
+	r := s.routing.resource
+	for _, entity := range []string{r.plural, r.singular} {
+		if name := strings.Replace(s.Name, entity, "", 1); name != s.Name && name != "" {
+			return lowerFirstCharacter(name)
+		}
+	}
+	return lowerFirstCharacter(s.Name)
+}
+
+func (s *Service) resourceHttpMethod() string {
+	switch s.routing.standard {
+	case standardGet, standardList:
+		return "get"
+	case standardCreate:
+		return "post"
+	case standardUpdate:
+		if s.FieldMask {
+			return "patch"
+		}
+		return "put"
+	case standardDelete:
+		return "delete"
+	}
+	if s.defaultHttpMethod() == "get" {
+		return "get"
+	}
+	return "post"
+}
+
+func (s *Service) resourceHttpPath() string {
+	r := s.routing.resource
+	if r == nil {
+		return "/v1:" + s.routing.custom
+	}
+	path := "/v1"
+	if parents := r.parents(); len(parents) > 0 && s.hasFields(parents, false) {
+		path += nestedPath(parents, lowerFirstCharacter)
+	}
+	path += "/" + r.collection
+	if s.routing.standard == standardList || s.routing.standard == standardCreate {
+		return path
+	}
+	if s.hasKeys(false) {
+		path = fmt.Sprintf("%s/{%s}", path, r.keys[len(r.keys)-1])
+	}
+	if s.routing.custom != "" {
+		path += ":" + s.routing.custom
+	}
+	return path
+}
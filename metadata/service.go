@@ -3,17 +3,152 @@ package metadata
 import (
 	"fmt"
 	"strings"
+
+	"github.com/emicklei/proto"
 )
 
 type Service struct {
 	Name                string
+	Query               string
 	InputNames          []string
 	InputTypes          []string
 	Output              string
 	Sql                 string
+	ServerStreaming     bool
+	ClientStreaming     bool
+	Batch               bool
+	NotFoundOnZeroRows  bool
+	Paginated           bool
+	FieldMask           bool
+	IteratorBody        string
 	Messages            map[string]*Message
 	CustomProtoComments []string
 	CustomProtoOptions  []string
+
+	lastInsertID bool
+	pageLimit    *Field
+	pageOffset   *Field
+	pageKeys     []*pageKey
+	directives   map[string]string
+	getter       *Service
+	getterKeys   []*Field
+	dbArgument   bool
+	routing      *routing
+	overrides    *typeOverrides
+	// the nested path is bound to other queries too
+	sharedNestedPath bool
+	// the RPC and its google.api.http and visibility options on the existing proto file
+	protoRPC         *proto.RPC
+	protoHttpOptions []string
+}
+
+func (p *Package) addService(name string, inputNames, inputTypes []string, output, sql, iterator string, comments []string) error {
+	service := Service{
+		Name:       name,
+		Query:      name,
+		InputNames: inputNames,
+		InputTypes: inputTypes,
+		Output:     output,
+		Sql:        sql,
+		Messages:   p.Messages,
+		overrides:  p.overrides,
+		directives: parseDirectives(append(comments, sqlComments(sql)...)),
+		dbArgument: p.EmitDbArgument,
+	}
+	if err := service.validateDirectives(); err != nil {
+		return err
+	}
+	if _, ok := service.directives["skip"]; ok {
+		return nil
+	}
+	if rpcName := service.directives["name"]; rpcName != "" {
+		service.Name = rpcName
+		if service.HasCustomParams() {
+			if m, ok := p.Messages[canonicalName(service.InputTypes[0])]; ok {
+				m.requestName = rpcName + "Request"
+			}
+		}
+		name = rpcName
+	}
+	if iterator != "" && service.HasArrayOutput() && queryCommand(sql) == ":many" {
+		stream := service.directives["stream"] == "server"
+		for _, re := range p.serverStreaming {
+			if re.MatchString(service.Query) && service.directives["stream"] != "none" {
+				stream = true
+				break
+			}
+		}
+		if stream {
+			service.ServerStreaming = true
+			service.IteratorBody = iterator
+		}
+	} else if service.directives["stream"] == "server" {
+		return fmt.Errorf("%s: only the :many queries can be server-streaming", service.Query)
+	}
+	service.ClientStreaming = service.isCopyFrom()
+	service.Batch = strings.HasPrefix(queryCommand(sql), ":batch") && service.HasArrayParams()
+	if err := service.paginate(); err != nil {
+		return err
+	}
+	if service.isExecRows() || service.isExecResult() {
+		command := sqlCommand(sql)
+		service.NotFoundOnZeroRows = p.zeroRowsNotFound && (command == "UPDATE" || command == "DELETE")
+		// the PostgreSQL drivers don't support LastInsertId
+		service.lastInsertID = p.Engine == "mysql" || p.Engine == "sqlite"
+	}
+	p.Services = append(p.Services, &service)
+
+	if !service.HasCustomParams() {
+		reqMessageName := name + "Params"
+		if _, ok := p.Messages[reqMessageName]; !ok {
+			fields := make([]*Field, 0)
+			for i, name := range service.InputNames {
+				typ := service.InputTypes[i]
+				if service.Batch {
+					// each request is an item of the batch
+					typ = strings.TrimPrefix(typ, "[]")
+				}
+				fields = append(fields, &Field{Name: name, Type: typ})
+			}
+			p.Messages[reqMessageName] = &Message{
+				Name:   reqMessageName,
+				Fields: fields,
+			}
+		}
+	}
+
+	resMessageName := name + "Response"
+	if _, ok := p.Messages[resMessageName]; !ok {
+		fields := make([]*Field, 0)
+		if service.Batch {
+			fields = append(fields, &Field{Name: "index", Type: "int32"}, &Field{Name: "error", Type: "status.Status"})
+		}
+		if service.ServerStreaming {
+			fields = append(fields, &Field{Name: service.streamFieldName(), Type: toProtoType(service.streamElementType(), service.overrides)})
+		} else if service.isExecRows() || service.isExecResult() {
+			fields = append(fields, &Field{Name: "rows_affected", Type: "int64"})
+			if service.isExecResult() && service.lastInsertID {
+				fields = append(fields, &Field{Name: "last_insert_id", Type: "int64"})
+			}
+		} else if !service.EmptyOutput() {
+
+			name := "value"
+			if service.HasArrayOutput() {
+				name = "list"
+			} else if service.HasCustomOutput() {
+				name = ToSnakeCase(canonicalName(service.Output))
+			}
+			fields = append(fields, &Field{Name: name, Type: toProtoType(service.Output, service.overrides)})
+			if service.Paginated {
+				fields = append(fields, &Field{Name: nextPageTokenField, Type: "string"})
+			}
+		}
+		p.Messages[resMessageName] = &Message{
+			Name:   resMessageName,
+			Fields: fields,
+		}
+	}
+	return nil
 }
 
 func (s *Service) ParamsCallDatabase() string {
@@ -34,21 +169,201 @@ func (s *Service) InputGrpc() []string {
 		in := s.InputNames[0]
 		res = append(res, fmt.Sprintf("var %s %s", in, typ))
 		m := s.Messages[canonicalName(typ)]
+		if s.FieldMask {
+			return append(res, s.fieldMaskInputGrpc(m)...)
+		}
 		for _, f := range m.Fields {
+			if s.Paginated && isPageField(f) {
+				continue
+			}
 			attrName := UpperFirstCharacter(f.Name)
-			res = append(res, bindToGo("req", fmt.Sprintf("%s.%s", in, attrName), attrName, f.Type, false)...)
+			res = append(res, bindToGo("req", fmt.Sprintf("%s.%s", in, attrName), attrName, f.Type, false, s.overrides)...)
+		}
+		if s.Paginated {
+			res = append(res, s.paginationInputGrpc()...)
 		}
 	} else {
 		for i, n := range s.InputNames {
-			res = append(res, bindToGo("req", n, UpperFirstCharacter(n), s.InputTypes[i], true)...)
+			res = append(res, bindToGo("req", n, UpperFirstCharacter(n), adjustType(s.InputTypes[i], s.Messages), true, s.overrides)...)
 		}
 	}
 
+	if s.ServerStreaming {
+		return streamReturns(res)
+	}
+
+	return res
+}
+
+// ClientStreamInputGrpc binds each received message to an item of the :copyfrom or :batch* methods
+func (s *Service) ClientStreamInputGrpc() []string {
+	res := make([]string, 0)
+	typ := s.copyFromElementType()
+	if !customType(typ) || isEnumType(adjustType(typ, s.Messages)) {
+		res = append(res, bindToGo("req", "item", UpperFirstCharacter(s.InputNames[0]), adjustType(typ, s.Messages), true, s.overrides)...)
+		return streamReturns(res)
+	}
+	if strings.HasPrefix(typ, "*") {
+		res = append(res, fmt.Sprintf("item := new(%s)", typ[1:]))
+	} else {
+		res = append(res, fmt.Sprintf("var item %s", typ))
+	}
+	if m, ok := s.Messages[canonicalName(typ)]; ok {
+		for _, f := range m.Fields {
+			attrName := UpperFirstCharacter(f.Name)
+			res = append(res, bindToGo("req", "item."+attrName, attrName, f.Type, false, s.overrides)...)
+		}
+	}
+	return streamReturns(res)
+}
+
+// CopyFromElementType is the Go type of each row of a :copyfrom method
+// CopyFromElementType is the Go type of the items of the :copyfrom and batch calls
+func (s *Service) CopyFromElementType() string {
+	return goType(s.copyFromElementType())
+}
+
+func (s *Service) copyFromElementType() string {
+	return strings.TrimPrefix(s.InputTypes[0], "[]")
+}
+
+// BatchResultsMethod is the method of the *<Query>BatchResults that calls back with the result of each item
+func (s *Service) BatchResultsMethod() string {
+	switch queryCommand(s.Sql) {
+	case ":batchone":
+		return "QueryRow"
+	case ":batchmany":
+		return "Query"
+	}
+	return "Exec"
+}
+
+// BatchOutputGrpc binds the result r of an item of the batch to the response res
+func (s *Service) BatchOutputGrpc() []string {
+	res := make([]string, 0)
+	if s.EmptyOutput() {
+		return res
+	}
+	typ := adjustType(s.Output, s.Messages)
+	switch {
+	case isEnumType(typ):
+		res = append(res, enumToProto("r", "res.Value", typ)...)
+	case s.HasArrayOutput() && customType(s.streamElementType()):
+		res = append(res, "for _, v := range r {")
+		res = append(res, fmt.Sprintf("res.List = append(res.List, to%s(v))", canonicalName(s.Output)))
+		res = append(res, "}")
+	case s.HasArrayOutput():
+		res = append(res, "res.List = r")
+	case s.HasCustomOutput():
+		res = append(res, fmt.Sprintf("res.%s = to%s(r)", camelCaseProto(canonicalName(s.Output)), canonicalName(s.Output)))
+	default:
+		res = append(res, "res.Value = r")
+	}
+	return res
+}
+
+// isCopyFrom checks for the :copyfrom methods (bulk inserts), which take a slice of params
+func (s *Service) isCopyFrom() bool {
+	if !s.HasArrayParams() || len(s.InputTypes) != 1 || !customType(s.copyFromElementType()) {
+		return false
+	}
+	if cmd := queryCommand(s.Sql); cmd != "" {
+		return cmd == ":copyfrom"
+	}
+	// sqlc doesn't write a query constant for the methods using the driver's bulk copy
+	return s.Output == "int64"
+}
+
+// streamReturns adapts the error handling of the bindings to the streaming handlers, which return only the error
+func streamReturns(lines []string) []string {
+	for i, l := range lines {
+		lines[i] = strings.ReplaceAll(l, "return nil, err", "return err")
+	}
+	return lines
+}
+
+// StreamElementType is the Go type of each row sent by a server-streaming RPC
+// StreamElementType is the Go type of the rows sent by the server-streaming RPCs
+func (s *Service) StreamElementType() string {
+	return goType(s.streamElementType())
+}
+
+func (s *Service) streamElementType() string {
+	return strings.TrimPrefix(s.Output, "[]")
+}
+
+// OutputGoType is the Go type of the result of the sqlc method
+func (s *Service) OutputGoType() string {
+	return goType(s.Output)
+}
+
+func (s *Service) streamFieldName() string {
+	typ := s.streamElementType()
+	if customType(typ) && !isEnumType(adjustType(typ, s.Messages)) {
+		return ToSnakeCase(canonicalName(typ))
+	}
+	return "value"
+}
+
+// ParamsSignature returns the parameters of the sqlc method, without the context and the database
+func (s *Service) ParamsSignature() string {
+	var sb strings.Builder
+	for i, n := range s.InputNames {
+		sb.WriteString(fmt.Sprintf(", %s %s", n, goType(s.InputTypes[i])))
+	}
+	return sb.String()
+}
+
+func (s *Service) StreamOutputGrpc() []string {
+	res := make([]string, 0)
+	typ := s.streamElementType()
+	if adjusted := adjustType(typ, s.Messages); isEnumType(adjusted) || !customType(typ) {
+		if value := valueToProto("r", "res.Value", adjusted, s.overrides); len(value) > 1 || value[0] != "res.Value = r" {
+			res = append(res, fmt.Sprintf("res := new(pb.%sResponse)", s.Name))
+			res = append(res, value...)
+			res = append(res, "return stream.Send(res)")
+			return res
+		}
+	}
+	if customType(typ) {
+		res = append(res, fmt.Sprintf("return stream.Send(&pb.%sResponse{%s: to%s(r)})", s.Name, camelCaseProto(canonicalName(typ)), canonicalName(typ)))
+		return res
+	}
+	res = append(res, fmt.Sprintf("return stream.Send(&pb.%sResponse{Value: r})", s.Name))
 	return res
 }
 
 func (s *Service) OutputGrpc() []string {
+	if s.Paginated {
+		return s.paginationOutputGrpc()
+	}
 	res := make([]string, 0)
+	if s.isExecRows() {
+		res = append(res, s.zeroRowsNotFound("result")...)
+		res = append(res, fmt.Sprintf("return &pb.%sResponse{RowsAffected: result}, nil", s.Name))
+		return res
+	}
+	if s.isExecResult() {
+		if s.Output == "pgconn.CommandTag" {
+			res = append(res, "rowsAffected := result.RowsAffected()")
+		} else {
+			res = append(res, "rowsAffected, err := result.RowsAffected()")
+			res = append(res, "if err != nil {")
+			res = append(res, "return nil, err")
+			res = append(res, "}")
+		}
+		res = append(res, s.zeroRowsNotFound("rowsAffected")...)
+		if !s.lastInsertID {
+			res = append(res, fmt.Sprintf("return &pb.%sResponse{RowsAffected: rowsAffected}, nil", s.Name))
+			return res
+		}
+		res = append(res, "lastInsertID, err := result.LastInsertId()")
+		res = append(res, "if err != nil {")
+		res = append(res, "return nil, err")
+		res = append(res, "}")
+		res = append(res, fmt.Sprintf("return &pb.%sResponse{RowsAffected: rowsAffected, LastInsertId: lastInsertID}, nil", s.Name))
+		return res
+	}
 	if s.HasArrayOutput() {
 		res = append(res, fmt.Sprintf("res := new(pb.%sResponse)", s.Name))
 		res = append(res, "for _, r := range result {")
@@ -64,6 +379,10 @@ func (s *Service) OutputGrpc() []string {
 	}
 	if s.EmptyOutput() {
 		res = append(res, fmt.Sprintf("return &pb.%sResponse{}, nil", s.Name))
+	} else if value := valueToProto("result", "res.Value", adjustType(s.Output, s.Messages), s.overrides); len(value) > 1 || value[0] != "res.Value = result" {
+		res = append(res, fmt.Sprintf("res := new(pb.%sResponse)", s.Name))
+		res = append(res, value...)
+		res = append(res, "return res, nil")
 	} else {
 		res = append(res, fmt.Sprintf("return &pb.%sResponse{Value: result}, nil", s.Name))
 	}
@@ -71,12 +390,33 @@ func (s *Service) OutputGrpc() []string {
 	return res
 }
 
+func (s *Service) zeroRowsNotFound(rowsAffected string) []string {
+	if !s.NotFoundOnZeroRows {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("if %s == 0 {", rowsAffected),
+		"return nil, status.Error(codes.NotFound, \"no rows affected\")",
+		"}",
+	}
+}
+
+// isExecRows checks for the :execrows methods, which return the number of affected rows
+func (s *Service) isExecRows() bool {
+	return s.Output == "int64" && queryCommand(s.Sql) == ":execrows"
+}
+
+// isExecResult checks for the :execresult methods, which return the database/sql result or the pgx command tag
+func (s *Service) isExecResult() bool {
+	return (s.Output == "sql.Result" || s.Output == "pgconn.CommandTag") && queryCommand(s.Sql) == ":execresult"
+}
+
 func (s *Service) HasCustomParams() bool {
 	if s.EmptyInput() {
 		return false
 	}
 
-	return customType(s.InputTypes[0])
+	return customType(s.InputTypes[0]) && !isEnumType(adjustType(s.InputTypes[0], s.Messages))
 }
 
 func (s *Service) HasSimpleParams() bool {
@@ -108,7 +448,7 @@ func (s *Service) HasCustomOutput() bool {
 		return false
 	}
 
-	return customType(s.Output)
+	return customType(s.Output) && !isEnumType(adjustType(s.Output, s.Messages))
 }
 
 func (s *Service) HasArrayOutput() bool {
@@ -126,6 +466,16 @@ func (s *Service) EmptyOutput() bool {
 	return s.Output == ""
 }
 
+// queryCommand returns the sqlc command (:one, :many, :exec...) of the query header "-- name: Name :cmd"
+func queryCommand(sql string) string {
+	header := strings.SplitN(strings.TrimPrefix(sql, "`"), "\n", 2)[0]
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[1] != "name:" {
+		return ""
+	}
+	return fields[3]
+}
+
 func (s *Service) ProtoOutputs() string {
 	if s.EmptyOutput() {
 		return ""
@@ -136,5 +486,5 @@ func (s *Service) ProtoOutputs() string {
 	} else if s.HasCustomOutput() {
 		name = ToSnakeCase(canonicalName(s.Output))
 	}
-	return fmt.Sprintf("    %s %s = 1;\n", toProtoType(s.Output), name)
+	return fmt.Sprintf("    %s %s = 1;\n", toProtoType(s.Output, s.overrides), name)
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/walterwanderley/sqlc-grpc/metadata"
+)
+
+// paginationTest runs on a module with the rendered pagination package
+const paginationTest = `package pagination
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"paging/internal/validation"
+)
+
+func TestPageToken(t *testing.T) {
+	requestHash, err := RequestHash(wrapperspb.String("filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := Decode("ListAuthors", requestHash, "")
+	if err != nil || first.Keys != nil || first.Offset != 0 {
+		t.Fatalf("Decode of the first page = %v, %v", first, err)
+	}
+
+	created := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	keys, err := Keys("Ann", int64(42), created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := Encode(Token{Method: "ListAuthors", Request: requestHash, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := Decode("ListAuthors", requestHash, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the binding of the generated code for the params sql.NullString, int64 and sql.NullTime
+	var name string
+	var id int64
+	var at time.Time
+	for i, v := range []interface{}{&name, &id, &at} {
+		if err := next.Key(i, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := sql.NullString{String: name, Valid: true}
+	if after.String != "Ann" || id != 42 || !at.Equal(created) {
+		t.Errorf("keys = %q, %d, %v", after.String, id, at)
+	}
+	if err := next.Key(3, &id); !errors.Is(err, validation.ErrUserInput) {
+		t.Errorf("Key out of range error = %v", err)
+	}
+	if err := next.Key(0, &id); !errors.Is(err, validation.ErrUserInput) {
+		t.Errorf("Key of another type error = %v", err)
+	}
+
+	offset, err := Encode(Token{Method: "ListAuthors", Request: requestHash, Offset: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Decode("ListAuthors", requestHash, offset); err != nil || got.Offset != 20 {
+		t.Errorf("Decode(offset) = %v, %v", got, err)
+	}
+
+	b, _ := base64.RawURLEncoding.DecodeString(token)
+	b[len(b)-2] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(b)
+	otherHash, err := RequestHash(wrapperspb.String("other filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := []struct {
+		name, method, request, token string
+	}{
+		{"tampered", "ListAuthors", requestHash, tampered},
+		{"truncated", "ListAuthors", requestHash, token[:20]},
+		{"not base64", "ListAuthors", requestHash, "!" + token},
+		{"other method", "ListBooks", requestHash, token},
+		{"other request", "ListAuthors", otherHash, token},
+	}
+	for _, tt := range invalid {
+		if _, err := Decode(tt.method, tt.request, tt.token); !errors.Is(err, validation.ErrUserInput) {
+			t.Errorf("%s: Decode error = %v, want validation.ErrUserInput", tt.name, err)
+		}
+	}
+
+	SetSecret([]byte("another secret"))
+	if _, err := Decode("ListAuthors", requestHash, token); !errors.Is(err, validation.ErrUserInput) {
+		t.Errorf("Decode with another secret error = %v, want validation.ErrUserInput", err)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for _, tt := range []struct{ size, want int32 }{{0, 100}, {10, 10}, {100, 100}, {500, 100}} {
+		if got, err := PageSize(tt.size, 100); err != nil || got != tt.want {
+			t.Errorf("PageSize(%d) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+	if _, err := PageSize(-1, 100); !errors.Is(err, validation.ErrUserInput) {
+		t.Errorf("PageSize(-1) error = %v, want validation.ErrUserInput", err)
+	}
+}
+`
+
+func TestPaginationToken(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	// the version of the protobuf module of this project, already on the module cache
+	version, err := exec.Command(goBin, "list", "-m", "-f", "{{.Version}}", "google.golang.org/protobuf").Output()
+	if err != nil {
+		t.Skip("protobuf module not found: ", err)
+	}
+	files := map[string]string{
+		"go.mod":                                 "module paging\n\ngo 1.19\n\nrequire google.golang.org/protobuf " + strings.TrimSpace(string(version)) + "\n",
+		"internal/pagination/pagination_test.go": paginationTest,
+	}
+	for _, name := range []string{"internal/pagination/pagination.go.tmpl", "internal/validation/validation.go.tmpl"} {
+		src, err := fs.ReadFile(embeddedTemplates(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpl, err := template.New(name).Parse(string(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, &metadata.Definition{GoModule: "paging"}); err != nil {
+			t.Fatal(err)
+		}
+		files[strings.TrimSuffix(name, ".tmpl")] = buf.String()
+	}
+	goTest(t, files)
+}
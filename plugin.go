@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sqlc-dev/plugin-sdk-go/codegen"
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+
+	"github.com/walterwanderley/sqlc-grpc/metadata"
+)
+
+const pluginMethodPrefix = "/plugin.CodegenService/"
+
+// pluginOptions are the "options" of the sqlc codegen configuration
+type pluginOptions struct {
+	Module                    string       `json:"module"`
+	Path                      string       `json:"path"`
+	Package                   string       `json:"package"`
+	SqlPackage                string       `json:"sql_package"`
+	Append                    bool         `json:"append"`
+	IgnoreQueries             string       `json:"ignore_queries"`
+	StreamQueries             string       `json:"stream_queries"`
+	CopyFromBatchSize         int          `json:"copyfrom_batch_size"`
+	ZeroRowsNotFound          bool         `json:"zero_rows_not_found"`
+	MaxPageSize               int          `json:"max_page_size"`
+	FieldMask                 bool         `json:"field_mask"`
+	Resource                  bool         `json:"resource"`
+	Templates                 string       `json:"templates"`
+	Types                     []typeConfig `json:"types"`
+	EmitInterface             bool         `json:"emit_interface"`
+	EmitResultStructPointers  bool         `json:"emit_result_struct_pointers"`
+	EmitParamsStructPointers  bool         `json:"emit_params_struct_pointers"`
+	EmitMethodsWithDBArgument bool         `json:"emit_methods_with_db_argument"`
+	EmitExactTableNames       bool         `json:"emit_exact_table_names"`
+}
+
+// isPluginCall checks if sqlc executed this program as a process codegen plugin
+func isPluginCall() bool {
+	return len(os.Args) > 1 && strings.HasPrefix(os.Args[1], pluginMethodPrefix)
+}
+
+func runPlugin() {
+	codegen.Run(generate)
+}
+
+func generate(ctx context.Context, req *plugin.GenerateRequest) (*plugin.GenerateResponse, error) {
+	// stdout is reserved to the plugin response
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	var opts pluginOptions
+	if len(req.PluginOptions) > 0 {
+		if err := json.Unmarshal(req.PluginOptions, &opts); err != nil {
+			return nil, fmt.Errorf("invalid plugin options: %w", err)
+		}
+	}
+	if opts.Path == "" {
+		return nil, fmt.Errorf("the plugin option \"path\" is required (the gen.go.out of the sqlc package)")
+	}
+	if opts.Module == "" {
+		opts.Module = moduleFromGoMod()
+	}
+	if opts.Module == "" {
+		opts.Module = module
+	}
+
+	if opts.Templates != "" {
+		if err := overrideTemplates(opts.Templates); err != nil {
+			return nil, fmt.Errorf("invalid templates directory: %w", err)
+		}
+	}
+
+	serverStreaming, err := queriesRegex(opts.StreamQueries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin option \"stream_queries\": %w", err)
+	}
+	queriesToIgnore, err := queriesRegex(opts.IgnoreQueries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin option \"ignore_queries\": %w", err)
+	}
+
+	pkg, err := metadata.ParseGenerateRequest(req, metadata.PackageOpts{
+		Path:                filepath.Clean(opts.Path),
+		Package:             opts.Package,
+		SqlPackage:          opts.SqlPackage,
+		EmitInterface:       opts.EmitInterface,
+		EmitParamsPointers:  opts.EmitParamsStructPointers,
+		EmitResultPointers:  opts.EmitResultStructPointers,
+		EmitDbArgument:      opts.EmitMethodsWithDBArgument,
+		EmitExactTableNames: opts.EmitExactTableNames,
+		ServerStreaming:     serverStreaming,
+		CopyFromBatchSize:   opts.CopyFromBatchSize,
+		ZeroRowsNotFound:    opts.ZeroRowsNotFound,
+		MaxPageSize:         opts.MaxPageSize,
+		FieldMask:           opts.FieldMask,
+		Resource:            opts.Resource,
+		TypeOverrides:       typeOverrides(opts.Types),
+	}, queriesToIgnore)
+	if err != nil {
+		return nil, err
+	}
+	pkg.GoModule = opts.Module
+	if len(pkg.Services) == 0 {
+		return nil, fmt.Errorf("no services found on package %s", pkg.Package)
+	}
+
+	def := metadata.Definition{
+		Args:     "sqlc generate",
+		GoModule: opts.Module,
+		Packages: []*metadata.Package{pkg},
+	}
+
+	out := "."
+	if req.Settings != nil && req.Settings.Codegen != nil && req.Settings.Codegen.Out != "" {
+		out = req.Settings.Codegen.Out
+	}
+	files, err := render(&def, out, opts.Append, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := filepath.Abs(out)
+	if err != nil {
+		return nil, err
+	}
+	res := new(plugin.GenerateResponse)
+	for _, f := range files {
+		if f.Skipped {
+			continue
+		}
+		name, err := pluginFileName(root, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		res.Files = append(res.Files, &plugin.File{Name: name, Contents: f.Content})
+	}
+	return res, nil
+}
+
+// pluginFileName returns the name of the file relative to the plugin out, sqlc writes the files only inside it
+func pluginFileName(root, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	name, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the plugin out %s, the \"path\" option must be inside it", path, root)
+	}
+	return filepath.ToSlash(name), nil
+}
+
+// queriesRegex compiles a comma separated list of regular expressions matching query names
+func queriesRegex(queries string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0)
+	for _, queryName := range strings.Split(queries, ",") {
+		s := strings.TrimSpace(queryName)
+		if s == "" {
+			continue
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
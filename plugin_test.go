@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sqlc-dev/plugin-sdk-go/plugin"
+)
+
+// authorsFixture is a plugin request with one table and its queries, generated on out with the plugin options
+func authorsFixture(out, options string) *plugin.GenerateRequest {
+	id := &plugin.Column{Name: "id", NotNull: true, Type: &plugin.Identifier{Name: "bigserial"}, Table: &plugin.Identifier{Name: "authors"}}
+	name := &plugin.Column{Name: "name", NotNull: true, Type: &plugin.Identifier{Name: "text"}, Table: &plugin.Identifier{Name: "authors"}}
+	bio := &plugin.Column{Name: "bio", Type: &plugin.Identifier{Name: "text"}, Table: &plugin.Identifier{Name: "authors"}}
+	return &plugin.GenerateRequest{
+		Settings: &plugin.Settings{Engine: "postgresql", Codegen: &plugin.Codegen{Out: out}},
+		Catalog: &plugin.Catalog{DefaultSchema: "public", Schemas: []*plugin.Schema{{
+			Name:   "public",
+			Tables: []*plugin.Table{{Rel: &plugin.Identifier{Name: "authors"}, Columns: []*plugin.Column{id, name, bio}}},
+		}}},
+		Queries: []*plugin.Query{
+			{
+				Name: "GetAuthor", Cmd: ":one", Text: "SELECT id, name, bio FROM authors WHERE id = $1",
+				Columns: []*plugin.Column{id, name, bio},
+				Params:  []*plugin.Parameter{{Number: 1, Column: id}},
+			},
+			{
+				Name: "CreateAuthor", Cmd: ":exec", Text: "INSERT INTO authors (name, bio) VALUES ($1, $2)",
+				Params: []*plugin.Parameter{{Number: 1, Column: name}, {Number: 2, Column: bio}},
+			},
+		},
+		PluginOptions: []byte(options),
+	}
+}
+
+func TestPluginFileNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		options string
+		want    []string
+		// the code of the files, with the Go and proto types of the columns
+		code    map[string][]string
+		wantErr string
+	}{
+		{
+			name:    "project root",
+			out:     ".",
+			options: `{"module": "authors", "path": "internal/author"}`,
+			want:    []string{"internal/author/service.go", "internal/author/adapters.go", "proto/author/v1/author.proto", "main.go", "registry.go"},
+			code: map[string][]string{
+				"internal/author/service.go":   {"arg.Bio = sql.NullString{Valid: true, String: v.Value}", "s.querier.GetAuthor(ctx, id)"},
+				"internal/author/adapters.go":  {"func toAuthor(in Author) *pb.Author", "out.Bio = wrapperspb.String(in.Bio.String)"},
+				"proto/author/v1/author.proto": {"int64 id = 1;", "string name = 2;", "google.protobuf.StringValue bio = 3;"},
+			},
+		},
+		{
+			name:    "package inside out",
+			out:     "gen",
+			options: `{"module": "authors", "path": "gen/internal/author"}`,
+			want:    []string{"internal/author/service.go", "proto/author/v1/author.proto", "main.go"},
+		},
+		{
+			name:    "package name",
+			out:     "./gen/",
+			options: `{"module": "authors", "path": "gen/internal/db", "package": "author"}`,
+			want:    []string{"internal/db/service.go", "proto/author/v1/author.proto"},
+		},
+		{
+			name:    "package outside out",
+			out:     "gen",
+			options: `{"module": "authors", "path": "internal/author"}`,
+			wantErr: "outside the plugin out",
+		},
+		{
+			name:    "without path",
+			out:     ".",
+			options: `{"module": "authors"}`,
+			wantErr: `"path" is required`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := generate(context.Background(), authorsFixture(tt.out, tt.options))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make(map[string]bool)
+			for _, f := range res.Files {
+				if strings.HasPrefix(f.Name, "/") || strings.HasPrefix(f.Name, "..") {
+					t.Errorf("file name %q is outside the plugin out", f.Name)
+				}
+				names[f.Name] = true
+				for _, code := range tt.code[f.Name] {
+					if !strings.Contains(string(f.Contents), code) {
+						t.Errorf("%s: %q not found on:\n%s", f.Name, code, f.Contents)
+					}
+				}
+			}
+			for _, name := range tt.want {
+				if !names[name] {
+					t.Errorf("%s not generated, got %v", name, names)
+				}
+			}
+		})
+	}
+}
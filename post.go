@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/walterwanderley/sqlc-grpc/metadata"
+)
+
+const (
+	stepModInit     = "mod-init"
+	stepTools       = "tools"
+	stepBufUpdate   = "buf-update"
+	stepBufGenerate = "buf-generate"
+	stepTidy        = "tidy"
+)
+
+var allPostSteps = []string{stepModInit, stepTools, stepBufUpdate, stepBufGenerate, stepTidy}
+
+// tools are installed with go install pkg@version, so the go.mod of the project doesn't require them
+var tools = map[string]string{
+	"protoc-gen-grpc-gateway": "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway@v2.18.0",
+	"protoc-gen-openapiv2":    "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2@v2.18.0",
+	"protoc-gen-go":           "google.golang.org/protobuf/cmd/protoc-gen-go@v1.31.0",
+	"protoc-gen-go-grpc":      "google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0",
+	"buf":                     "github.com/bufbuild/buf/cmd/buf@v1.28.1",
+}
+
+type postOptions struct {
+	steps map[string]bool
+	// offline uses the tools on PATH and the buf module cache, without network access
+	offline  bool
+	bufCache string
+}
+
+func parsePostSteps(list string) (map[string]bool, error) {
+	steps := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var valid bool
+		for _, step := range allPostSteps {
+			if s == step {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid post processing step %q, valid steps: %s", s, strings.Join(allPostSteps, ", "))
+		}
+		steps[s] = true
+	}
+	return steps, nil
+}
+
+// postProcess configures the go module and compiles the protocol buffers.
+// It stops on the first failed step.
+func postProcess(def *metadata.Definition, workingDirectory string, opts postOptions) error {
+	env := opts.env()
+	fmt.Printf("Configuring project %s...\n", def.GoModule)
+	if opts.steps[stepModInit] {
+		if fileExists(filepath.Join(workingDirectory, "go.mod")) {
+			fmt.Println("go.mod already exists, skipping go mod init")
+		} else if err := execCommand(workingDirectory, env, "go mod init "+def.GoModule); err != nil {
+			return err
+		}
+	}
+	if opts.steps[stepTools] {
+		if err := installTools(workingDirectory, env, opts.offline); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Compiling protocol buffers...")
+	if opts.steps[stepBufUpdate] {
+		if opts.offline {
+			if !fileExists(filepath.Join(workingDirectory, "proto", "buf.lock")) {
+				return fmt.Errorf("offline mode requires the proto/buf.lock file")
+			}
+			fmt.Println("Offline mode, skipping buf mod update")
+		} else if err := execCommand(filepath.Join(workingDirectory, "proto"), env, "buf mod update"); err != nil {
+			return err
+		}
+	}
+	if opts.steps[stepBufGenerate] {
+		if err := execCommand(workingDirectory, env, "buf generate"); err != nil {
+			return err
+		}
+	}
+	if opts.steps[stepTidy] {
+		if err := execCommand(workingDirectory, env, "go mod tidy"); err != nil {
+			return err
+		}
+	}
+	fmt.Println("Finished!")
+	return nil
+}
+
+// installTools installs the protoc plugins and buf. On offline mode it only checks if they are on PATH.
+func installTools(workingDirectory string, env []string, offline bool) error {
+	if offline {
+		missing := make([]string, 0)
+		for _, name := range sortedKeys(tools) {
+			if _, err := exec.LookPath(name); err != nil {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("offline mode requires the tools on PATH, not found: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	for _, name := range sortedKeys(tools) {
+		if err := execCommand(workingDirectory, env, "go install "+tools[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (opts postOptions) env() []string {
+	env := os.Environ()
+	if opts.offline {
+		if os.Getenv("GOPROXY") == "" {
+			env = append(env, "GOPROXY=off")
+		}
+		if os.Getenv("GOSUMDB") == "" {
+			env = append(env, "GOSUMDB=off")
+		}
+	}
+	if opts.bufCache != "" {
+		if dir, err := filepath.Abs(opts.bufCache); err == nil {
+			env = append(env, "BUF_CACHE_DIR="+dir)
+		}
+	}
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func execCommand(dir string, env []string, command string) error {
+	line := strings.Split(command, " ")
+	cmd := exec.Command(line[0], line[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("[error] %q: %w", command, err)
+	}
+	return nil
+}